@@ -0,0 +1,185 @@
+//
+// adopt.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// LabelStatusDir defines the label of sandbox containers which has the
+	// host directory results of steps are written in.
+	LabelStatusDir = "roadie-queue-manager.status-dir"
+	// LabelResult defines the label of sandbox containers which has the
+	// location results of the task are uploaded to.
+	LabelResult = "roadie-queue-manager.result"
+	// LabelDeadline defines the label of sandbox containers which has the
+	// time the task times out in RFC3339.
+	LabelDeadline = "roadie-queue-manager.deadline"
+)
+
+// RunningContainer defines a sandbox container still running.
+type RunningContainer struct {
+	ID     string
+	Labels map[string]string
+}
+
+// Adopter is implemented by executors whose containers keep running after
+// this queue manager exits, so that they can be waited for after a restart.
+type Adopter interface {
+	// RunningContainer returns a running container of a given task, or nil if
+	// no containers of the task are running.
+	RunningContainer(ctx context.Context, task string) (*RunningContainer, error)
+	// Attach writes outputs of a running container since it started to given
+	// writers until it ends; it returns an error if the container exits with a non-zero
+	// status. The container is killed if the context is canceled.
+	Attach(ctx context.Context, id string, keepFailed bool, stdout, stderr io.Writer) error
+}
+
+// RunningContainer returns a running container labelled with a given task.
+func (e *DockerExecutor) RunningContainer(ctx context.Context, task string) (res *RunningContainer, err error) {
+
+	docker, err := client.NewEnvClient()
+	if err != nil {
+		return
+	}
+	defer docker.Close()
+
+	// Only running containers are listed by default.
+	containers, err := docker.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return
+	}
+	for _, c := range containers {
+		if c.Labels[LabelTask] == task && c.State == "running" {
+			return &RunningContainer{
+				ID:     c.ID,
+				Labels: c.Labels,
+			}, nil
+		}
+	}
+	return
+
+}
+
+// Attach waits for a running container via the Docker API.
+func (e *DockerExecutor) Attach(ctx context.Context, id string, keepFailed bool, stdout, stderr io.Writer) (err error) {
+
+	docker, err := client.NewEnvClient()
+	if err != nil {
+		return
+	}
+	defer docker.Close()
+	return AttachContainer(ctx, docker, id, keepFailed, stdout, stderr)
+
+}
+
+// adoptContainer waits for a container of a script still running after a
+// restart instead of running the script again, and records its results in
+// a given task result; it returns false if no containers of the script are
+// running.
+func adoptContainer(ctx context.Context, executor Executor, s *Script, cfg *Config, res *TaskResult, secrets [][]byte, logger *log.Logger) (adopted bool, err error) {
+
+	adopter, ok := executor.(Adopter)
+	if !ok {
+		return
+	}
+	c, err := adopter.RunningContainer(ctx, s.Name)
+	if err != nil {
+		// The script runs again since running containers are unknown.
+		logger.Println("Cannot find running containers of task", s.Name, ":", err.Error())
+		return false, nil
+	} else if c == nil {
+		return
+	}
+	adopted = true
+	logger.Println("Adopting running container", c.ID, "of task", s.Name)
+	res.Result = c.Labels[LabelResult]
+
+	// The deadline of the original run is kept.
+	runCtx := ctx
+	if v, ok := c.Labels[LabelDeadline]; ok {
+		var deadline time.Time
+		if deadline, err = time.Parse(time.RFC3339, v); err != nil {
+			return
+		}
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	streamer := NewOutputStreamer(runCtx, s.Name, logger, cfg.LogSink, secrets)
+	stdout := streamer.Writer(StreamStdout)
+	stderr := streamer.Writer(StreamStderr)
+	err = adopter.Attach(runCtx, c.ID, cfg.Cleanup != nil && cfg.Cleanup.FailedContainers > 0, stdout, stderr)
+	stdout.Flush()
+	stderr.Flush()
+	if runCtx.Err() == context.DeadlineExceeded {
+		res.Status = TaskTimeout
+		err = fmt.Errorf("killed because of the timeout %v", s.Timeout)
+	}
+
+	statusDir := c.Labels[LabelStatusDir]
+	if statusDir == "" {
+		return
+	}
+	res.Steps = readStepResults(statusDir)
+	// The temporary directory the previous process created is also removed.
+	if dir := filepath.Dir(statusDir); strings.HasPrefix(filepath.Base(dir), "roadie") {
+		os.RemoveAll(dir)
+	}
+	return
+
+}
+
+// readStepResults reads all step results in a directory in the order the
+// steps started.
+func readStepResults(dir string) (steps []StepResult) {
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, filename := range matches {
+		r, err := ReadStepResult(filename)
+		if err != nil {
+			continue
+		}
+		steps = append(steps, *r)
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].StartedAt.Before(steps[j].StartedAt)
+	})
+	return
+
+}
@@ -0,0 +1,203 @@
+//
+// adopt_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAdopter is a fakeExecutor which also has running containers.
+type fakeAdopter struct {
+	fakeExecutor
+	running    map[string]*RunningContainer
+	runningErr error
+	attached   []string
+}
+
+func (e *fakeAdopter) RunningContainer(ctx context.Context, task string) (*RunningContainer, error) {
+	return e.running[task], e.runningErr
+}
+
+func (e *fakeAdopter) Attach(ctx context.Context, id string, keepFailed bool, stdout, stderr io.Writer) error {
+	e.attached = append(e.attached, id)
+	fmt.Fprint(stdout, e.output)
+	return e.err
+}
+
+func TestAdoptContainer(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "roadie")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// Step results written by the container before and after the restart.
+	statusDir := filepath.Join(dir, "status")
+	if err = os.Mkdir(statusDir, 0755); err != nil {
+		t.Fatal(err.Error())
+	}
+	now := time.Now()
+	for i, name := range []string{"prepare", "train"} {
+		err = WriteStepResult(filepath.Join(statusDir, fmt.Sprintf("%v.json", 1-i)), &StepResult{
+			Name:       name,
+			ExitStatus: i,
+			StartedAt:  now.Add(time.Duration(i) * time.Minute),
+			FinishedAt: now.Add(time.Duration(i+1) * time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	s := &Script{
+		Name:  "train",
+		Image: "python:3",
+		Run: []Step{
+			Step{Name: "prepare", Command: "pip install -r requirements.txt"},
+			Step{Name: "train", Command: "python train.py"},
+		},
+		Result: "gs://somebucket/{{task}}/{{attempt}}",
+	}
+	executor := &fakeAdopter{
+		fakeExecutor: fakeExecutor{
+			output: "resumed\n",
+		},
+		running: map[string]*RunningContainer{
+			"train": &RunningContainer{
+				ID: "abcdef",
+				Labels: map[string]string{
+					LabelTask:      "train",
+					LabelStatusDir: statusDir,
+					LabelResult:    "gs://somebucket/train/1/",
+				},
+			},
+		},
+	}
+	buf := bytes.NewBuffer(nil)
+	cfg := &Config{
+		Executor: executor,
+		Force:    true,
+	}
+
+	res, err := ExecuteScript(context.Background(), s, cfg, log.New(buf, "", 0))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(executor.attached) != 1 || executor.attached[0] != "abcdef" {
+		t.Errorf("Attached containers are %v, want [abcdef]", executor.attached)
+	}
+	if len(executor.builds) != 0 || executor.container != nil {
+		t.Error("The script runs again while its container is running")
+	}
+	if res.Result != "gs://somebucket/train/1/" {
+		t.Errorf("Result location is %v", res.Result)
+	}
+	if res.Status != TaskFailed || len(res.Steps) != 2 || res.Steps[0].Name != "prepare" || res.Steps[1].Name != "train" {
+		t.Errorf("Result is %+v", res)
+	}
+	if !strings.Contains(buf.String(), "resumed\n") {
+		t.Errorf("Outputs of the container aren't logged: %q", buf.String())
+	}
+	if _, err = os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("The temporary directory of the container isn't removed")
+	}
+
+	// The script runs if no containers of it are running.
+	executor.running = nil
+	if _, err = ExecuteScript(context.Background(), s, cfg, log.New(buf, "", 0)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if executor.container == nil {
+		t.Fatal("The script doesn't run")
+	}
+	labels := executor.container.Labels
+	if labels[LabelTask] != "train" || labels[LabelResult] != "gs://somebucket/train/1/" || labels[LabelStatusDir] == "" {
+		t.Errorf("Labels of the container are %v", labels)
+	}
+
+	// The script also runs if running containers cannot be listed.
+	executor.container = nil
+	executor.runningErr = fmt.Errorf("cannot connect to the daemon")
+	if _, err = ExecuteScript(context.Background(), s, cfg, log.New(buf, "", 0)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if executor.container == nil {
+		t.Error("The script doesn't run when running containers are unknown")
+	}
+
+}
+
+func TestPodmanAdopter(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// A fake podman command which has a running container of task train.
+	command := filepath.Join(dir, "podman")
+	err = ioutil.WriteFile(command, []byte(`#!/bin/sh
+case "$1" in
+  ps) echo '[{"Id": "abcdef", "Labels": {"`+LabelTask+`": "train"}}]';;
+  logs) echo "output of $3"; echo "error of $3" >&2;;
+  wait) echo 3;;
+esac
+`), 0755)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	e := &PodmanExecutor{Command: command}
+	c, err := e.RunningContainer(ctx, "train")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if c == nil || c.ID != "abcdef" || c.Labels[LabelTask] != "train" {
+		t.Errorf("Running container is %+v", c)
+	}
+	if c, err = e.RunningContainer(ctx, "evaluate"); err != nil || c != nil {
+		t.Errorf("Running container of another task is %+v (%v)", c, err)
+	}
+
+	stdout, stderr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	err = e.Attach(ctx, "abcdef", false, stdout, stderr)
+	if err == nil || !strings.Contains(err.Error(), "3") {
+		t.Errorf("Error of a failed container is %v", err)
+	}
+	if stdout.String() != "output of abcdef\n" || stderr.String() != "error of abcdef\n" {
+		t.Errorf("Outputs are %q and %q", stdout.String(), stderr.String())
+	}
+
+}
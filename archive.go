@@ -0,0 +1,489 @@
+//
+// archive.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// gzipMagic defines the first bytes of gzipped files.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ArchiveFormat defines a format of archive files which can be expanded.
+type ArchiveFormat string
+
+const (
+	// ArchiveNone means the file is not an archive and won't be expanded.
+	ArchiveNone ArchiveFormat = ""
+	// ArchiveZip defines the zip format.
+	ArchiveZip ArchiveFormat = "zip"
+	// ArchiveTar defines the tar format.
+	ArchiveTar ArchiveFormat = "tar"
+	// ArchiveTarGz defines the gzipped tar format.
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+	// ArchiveTarBz2 defines the bzip2ed tar format.
+	ArchiveTarBz2 ArchiveFormat = "tar.bz2"
+	// ArchiveTarXz defines the xz compressed tar format.
+	ArchiveTarXz ArchiveFormat = "tar.xz"
+	// ArchiveTarZstd defines the zstd compressed tar format.
+	ArchiveTarZstd ArchiveFormat = "tar.zst"
+	// ArchiveGz defines a single gzipped file.
+	ArchiveGz ArchiveFormat = "gz"
+)
+
+// archiveExtensions maps file extensions to archive formats.
+// Longer extensions must be checked before shorter ones, i.e. .tar.gz before .tar.
+var archiveExtensions = []struct {
+	Ext    string
+	Format ArchiveFormat
+}{
+	{".tar.gz", ArchiveTarGz},
+	{".tgz", ArchiveTarGz},
+	{".tar.bz2", ArchiveTarBz2},
+	{".tbz2", ArchiveTarBz2},
+	{".tar.xz", ArchiveTarXz},
+	{".txz", ArchiveTarXz},
+	{".tar.zst", ArchiveTarZstd},
+	{".tzst", ArchiveTarZstd},
+	{".zip", ArchiveZip},
+	{".tar", ArchiveTar},
+	{".gz", ArchiveGz},
+}
+
+// ArchiveFormatOf returns the archive format of a given file name based on
+// its extension; ArchiveNone is returned if the file isn't an archive.
+func ArchiveFormatOf(filename string) ArchiveFormat {
+
+	for _, v := range archiveExtensions {
+		if strings.HasSuffix(filename, v.Ext) {
+			return v.Format
+		}
+	}
+	return ArchiveNone
+
+}
+
+// ParseArchiveFormat checks a given string names a supported archive format.
+func ParseArchiveFormat(name string) (format ArchiveFormat, err error) {
+
+	if name == "tgz" {
+		return ArchiveTarGz, nil
+	}
+	for _, v := range archiveExtensions {
+		if v.Format == ArchiveFormat(name) {
+			return v.Format, nil
+		}
+	}
+	return ArchiveNone, fmt.Errorf("unsupported archive format: %v", name)
+
+}
+
+// Extract expands a given archive file into the directory the file belongs to.
+// The archive file is removed after it is expanded unless keep is true.
+//
+// A single gzipped file is decompressed to the file name without .gz;
+// if the file name doesn't have .gz, it is decompressed in place and
+// keep is ignored.
+func Extract(filename string, format ArchiveFormat, keep bool) (err error) {
+
+	dir := filepath.Dir(filename)
+	switch format {
+	case ArchiveNone:
+		return
+	case ArchiveZip:
+		err = extractZip(filename, dir)
+	case ArchiveGz:
+		return extractGz(filename, keep)
+	default:
+		err = extractTarFile(filename, dir, format)
+	}
+	if err != nil || keep {
+		return
+	}
+	return os.Remove(filename)
+
+}
+
+// extractZip expands a zip file into a given directory.
+func extractZip(filename, dir string) (err error) {
+
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	var links []string
+	for _, f := range r.File {
+
+		var path string
+		path, err = securePath(dir, f.Name)
+		if err != nil {
+			return
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = os.MkdirAll(path, 0755)
+
+		case mode&os.ModeSymlink != 0:
+			err = extractZipSymlink(f, dir, path)
+			links = append(links, path)
+
+		default:
+			err = extractZipFile(f, path)
+
+		}
+		if err != nil {
+			return
+		}
+
+	}
+	return verifySymlinks(dir, links)
+
+}
+
+// extractZipFile writes the contents of a zip entry to a given path.
+func extractZipFile(f *zip.File, path string) (err error) {
+
+	src, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	return writeFile(path, src, f.Mode())
+
+}
+
+// extractZipSymlink creates a symbolic link stored in a zip entry.
+func extractZipSymlink(f *zip.File, dir, path string) (err error) {
+
+	src, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	target := bytes.NewBuffer(nil)
+	if _, err = io.Copy(target, src); err != nil {
+		return
+	}
+	return createSymlink(dir, target.String(), path)
+
+}
+
+// extractGz decompresses a single gzipped file.
+func extractGz(filename string, keep bool) (err error) {
+
+	fp, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+
+	info, err := fp.Stat()
+	if err != nil {
+		return
+	}
+
+	dest := strings.TrimSuffix(filename, ".gz")
+	inPlace := dest == filename
+	if inPlace {
+		dest = filename + ".decompressed"
+	}
+
+	var r io.Reader
+	gz, err := gzip.NewReader(fp)
+	if err == gzip.ErrHeader {
+		// The file has been decompressed already, e.g. a server sent it with
+		// Content-Encoding: gzip and it was decoded while downloading.
+		if _, err = fp.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		r = fp
+	} else if err != nil {
+		return
+	} else {
+		defer gz.Close()
+		r = gz
+	}
+
+	if err = writeFile(dest, r, info.Mode()); err != nil {
+		os.Remove(dest)
+		return
+	}
+
+	if inPlace {
+		return os.Rename(dest, filename)
+	} else if !keep {
+		return os.Remove(filename)
+	}
+	return
+
+}
+
+// extractTarFile expands a possibly compressed tar file into a given directory.
+func extractTarFile(filename, dir string, format ArchiveFormat) (err error) {
+
+	fp, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+
+	var r io.Reader
+	switch format {
+	case ArchiveTar:
+		r = fp
+
+	case ArchiveTarGz:
+		// The file may have been decompressed already, e.g. a server sent it
+		// with Content-Encoding: gzip and it was decoded while downloading.
+		br := bufio.NewReader(fp)
+		var magic []byte
+		if magic, err = br.Peek(2); err != nil && err != io.EOF {
+			return
+		}
+		if !bytes.Equal(magic, gzipMagic) {
+			r = br
+			break
+		}
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(br)
+		if err != nil {
+			return
+		}
+		defer gz.Close()
+		r = gz
+
+	case ArchiveTarBz2:
+		r = bzip2.NewReader(fp)
+
+	case ArchiveTarXz:
+		r, err = xz.NewReader(fp)
+		if err != nil {
+			return
+		}
+
+	case ArchiveTarZstd:
+		var zr *zstd.Decoder
+		zr, err = zstd.NewReader(fp)
+		if err != nil {
+			return
+		}
+		defer zr.Close()
+		r = zr
+
+	default:
+		return fmt.Errorf("unsupported archive format: %v", format)
+
+	}
+	return extractTar(r, dir)
+
+}
+
+// extractTar expands a tar stream into a given directory.
+func extractTar(r io.Reader, dir string) (err error) {
+
+	var links []string
+	tr := tar.NewReader(r)
+	for {
+
+		var header *tar.Header
+		header, err = tr.Next()
+		if err == io.EOF {
+			return verifySymlinks(dir, links)
+		} else if err != nil {
+			return
+		}
+
+		var path string
+		path, err = securePath(dir, header.Name)
+		if err != nil {
+			return
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0755)
+
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeFile(path, tr, header.FileInfo().Mode())
+
+		case tar.TypeSymlink:
+			err = createSymlink(dir, header.Linkname, path)
+			links = append(links, path)
+
+		case tar.TypeLink:
+			var target string
+			target, err = securePath(dir, header.Linkname)
+			if err == nil {
+				err = os.Link(target, path)
+			}
+
+		default:
+			// Devices, FIFOs and other special files are not expanded.
+			continue
+
+		}
+		if err != nil {
+			return
+		}
+
+	}
+
+}
+
+// writeFile writes data read from a given reader to a file, creating parent
+// directories if necessary.
+func writeFile(path string, r io.Reader, mode os.FileMode) (err error) {
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := fp.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	_, err = io.Copy(fp, r)
+	return
+
+}
+
+// createSymlink creates a symbolic link at a given path after checking the
+// link doesn't point outside of dir.
+func createSymlink(dir, target, path string) (err error) {
+
+	if filepath.IsAbs(target) {
+		return fmt.Errorf("symbolic link %v points an absolute path %v", path, target)
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return
+	}
+	if _, err = securePath(dir, filepath.Dir(rel)+string(filepath.Separator)+target); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	return os.Symlink(target, path)
+
+}
+
+// securePath joins a directory and a file name stored in an archive, and
+// returns an error if the resultant path is outside of the directory,
+// i.e. the archive tries a zip slip attack. Paths passing through symbolic
+// links in the directory are also refused since they may lead outside.
+func securePath(dir, name string) (path string, err error) {
+
+	path = filepath.Join(dir, name)
+	if !withinDir(dir, path) {
+		return "", fmt.Errorf("archived file %v points outside of the target directory", name)
+	}
+
+	// Each component is checked before ".." is applied so that a/link/..
+	// is also refused.
+	cur := dir
+	for _, elem := range strings.Split(filepath.ToSlash(name), "/") {
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+			continue
+		}
+		cur = filepath.Join(cur, elem)
+		info, e := os.Lstat(cur)
+		if os.IsNotExist(e) {
+			continue
+		} else if e != nil {
+			return "", e
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("archived file %v passes through a symbolic link %v", name, cur)
+		}
+	}
+	return
+
+}
+
+// verifySymlinks checks symbolic links created while expanding an archive
+// resolve inside of the directory, because a link created later can change
+// where an earlier link points; links resolving outside are removed.
+func verifySymlinks(dir string, links []string) (err error) {
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return
+	}
+	for _, link := range links {
+		resolved, e := filepath.EvalSymlinks(link)
+		if os.IsNotExist(e) {
+			// A dangling link is checked by its target path instead.
+			var target string
+			if target, err = os.Readlink(link); err != nil {
+				return
+			}
+			var rel string
+			if rel, err = filepath.Rel(dir, filepath.Dir(link)); err != nil {
+				return
+			}
+			_, e = securePath(dir, rel+string(filepath.Separator)+target)
+		} else if e == nil && !withinDir(root, resolved) {
+			e = fmt.Errorf("symbolic link %v points outside of the target directory", link)
+		}
+		if e != nil {
+			os.Remove(link)
+			return e
+		}
+	}
+	return
+
+}
+
+// withinDir returns true if a path is in a directory.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
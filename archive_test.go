@@ -0,0 +1,370 @@
+//
+// archive_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// testFiles defines files stored in archives created in tests.
+var testFiles = map[string]string{
+	"sample.txt":     "sample file",
+	"dir/nested.txt": "nested file",
+}
+
+// createTar creates a tar archive consisting of given files.
+func createTar(w io.Writer, files map[string]string) (err error) {
+
+	tw := tar.NewWriter(w)
+	for name, body := range files {
+		err = tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(body)),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return
+		}
+		if _, err = tw.Write([]byte(body)); err != nil {
+			return
+		}
+	}
+	return tw.Close()
+
+}
+
+// createArchive creates an archive file of a given format in a directory.
+func createArchive(dir, name string, format ArchiveFormat, files map[string]string) (path string, err error) {
+
+	path = filepath.Join(dir, name)
+	fp, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+
+	switch format {
+	case ArchiveZip:
+		zw := zip.NewWriter(fp)
+		for name, body := range files {
+			var w io.Writer
+			if w, err = zw.Create(name); err != nil {
+				return
+			}
+			if _, err = w.Write([]byte(body)); err != nil {
+				return
+			}
+		}
+		err = zw.Close()
+
+	case ArchiveTar:
+		err = createTar(fp, files)
+
+	case ArchiveTarGz:
+		gw := gzip.NewWriter(fp)
+		if err = createTar(gw, files); err != nil {
+			return
+		}
+		err = gw.Close()
+
+	case ArchiveTarXz:
+		var xw *xz.Writer
+		if xw, err = xz.NewWriter(fp); err != nil {
+			return
+		}
+		if err = createTar(xw, files); err != nil {
+			return
+		}
+		err = xw.Close()
+
+	case ArchiveTarZstd:
+		var zw *zstd.Encoder
+		if zw, err = zstd.NewWriter(fp); err != nil {
+			return
+		}
+		if err = createTar(zw, files); err != nil {
+			return
+		}
+		err = zw.Close()
+
+	}
+	return
+
+}
+
+func TestArchiveFormatOf(t *testing.T) {
+
+	cases := map[string]ArchiveFormat{
+		"sample.zip":     ArchiveZip,
+		"sample.tar":     ArchiveTar,
+		"sample.tar.gz":  ArchiveTarGz,
+		"sample.tgz":     ArchiveTarGz,
+		"sample.tar.bz2": ArchiveTarBz2,
+		"sample.tar.xz":  ArchiveTarXz,
+		"sample.tar.zst": ArchiveTarZstd,
+		"sample.txt.gz":  ArchiveGz,
+		"sample.txt":     ArchiveNone,
+	}
+	for name, expect := range cases {
+		if res := ArchiveFormatOf(name); res != expect {
+			t.Errorf("Archive format of %v is %q, want %q", name, res, expect)
+		}
+	}
+
+	if _, err := ParseArchiveFormat("rar"); err == nil {
+		t.Error("Unsupported format is accepted")
+	}
+
+}
+
+func TestExtract(t *testing.T) {
+
+	cases := map[ArchiveFormat]string{
+		ArchiveZip:     "sample.zip",
+		ArchiveTar:     "sample.tar",
+		ArchiveTarGz:   "sample.tgz",
+		ArchiveTarXz:   "sample.tar.xz",
+		ArchiveTarZstd: "sample.tar.zst",
+	}
+	for format, name := range cases {
+
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer os.RemoveAll(dir)
+
+		path, err := createArchive(dir, name, format, testFiles)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if err = Extract(path, format, false); err != nil {
+			t.Errorf("Cannot expand %v: %v", name, err)
+			continue
+		}
+
+		for file, body := range testFiles {
+			data, err := ioutil.ReadFile(filepath.Join(dir, file))
+			if err != nil {
+				t.Errorf("%v doesn't have %v: %v", name, file, err)
+			} else if string(data) != body {
+				t.Errorf("%v in %v is %q, want %q", file, name, string(data), body)
+			}
+		}
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Archive file %v isn't removed", name)
+		}
+
+	}
+
+}
+
+func TestExtractKeep(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path, err := createArchive(dir, "sample.tar.gz", ArchiveTarGz, testFiles)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = Extract(path, ArchiveTarGz, true); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err = os.Stat(path); err != nil {
+		t.Error("Archive file is removed even if keep is set")
+	}
+
+}
+
+func TestExtractDecodedTarGz(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// A tar.gz file decoded by Content-Encoding: gzip while downloading.
+	path, err := createArchive(dir, "sample.tar.gz", ArchiveTar, testFiles)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = Extract(path, ArchiveFormatOf(path), false); err != nil {
+		t.Fatal(err.Error())
+	}
+	for file, body := range testFiles {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Errorf("Decoded archive doesn't have %v: %v", file, err)
+		} else if string(data) != body {
+			t.Errorf("%v in the decoded archive is %q, want %q", file, string(data), body)
+		}
+	}
+
+}
+
+func TestExtractZipSlip(t *testing.T) {
+
+	for _, format := range []ArchiveFormat{ArchiveZip, ArchiveTar} {
+
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer os.RemoveAll(dir)
+
+		target := filepath.Join(dir, "data")
+		if err = os.Mkdir(target, 0755); err != nil {
+			t.Fatal(err.Error())
+		}
+		path, err := createArchive(target, "evil."+string(format), format, map[string]string{
+			"../evil.txt": "evil",
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if err = Extract(path, format, false); err == nil {
+			t.Errorf("Archive in %v format writing outside the directory is expanded", format)
+		}
+		if _, err = os.Stat(filepath.Join(dir, "evil.txt")); !os.IsNotExist(err) {
+			t.Errorf("A file outside the directory is created from an archive in %v format", format)
+		}
+
+	}
+
+}
+
+func TestExtractSymlinkSlip(t *testing.T) {
+
+	cases := [][]tar.Header{
+		// Links relative to other links point outside of the directory.
+		[]tar.Header{
+			{Name: "a/", Typeflag: tar.TypeDir},
+			{Name: "a/b", Linkname: "..", Typeflag: tar.TypeSymlink},
+			{Name: "a/b/c", Linkname: "..", Typeflag: tar.TypeSymlink},
+			{Name: "a/b/c/evil.txt", Typeflag: tar.TypeReg},
+		},
+		// A link created later changes where an earlier link points.
+		[]tar.Header{
+			{Name: "x", Linkname: "a/b/../../evil.txt", Typeflag: tar.TypeSymlink},
+			{Name: "a/", Typeflag: tar.TypeDir},
+			{Name: "a/b", Linkname: "..", Typeflag: tar.TypeSymlink},
+		},
+	}
+	for i, headers := range cases {
+
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer os.RemoveAll(dir)
+
+		target := filepath.Join(dir, "data")
+		if err = os.Mkdir(target, 0755); err != nil {
+			t.Fatal(err.Error())
+		}
+		buf := bytes.NewBuffer(nil)
+		tw := tar.NewWriter(buf)
+		for _, h := range headers {
+			h.Mode = 0755
+			if err = tw.WriteHeader(&h); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		if err = tw.Close(); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if err = extractTar(buf, target); err == nil {
+			t.Errorf("Archive %v with symbolic links pointing outside is expanded", i)
+		}
+		if _, err = os.Lstat(filepath.Join(dir, "evil.txt")); !os.IsNotExist(err) {
+			t.Errorf("A file outside the directory is created from archive %v", i)
+		}
+		if _, err = os.Lstat(filepath.Join(target, "x")); err == nil {
+			t.Errorf("A symbolic link pointing outside is kept from archive %v", i)
+		}
+
+	}
+
+}
+
+func TestExtractGz(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	body := "sample file"
+	path := filepath.Join(dir, "sample.txt.gz")
+	fp, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	gw := gzip.NewWriter(fp)
+	gw.Write([]byte(body))
+	gw.Close()
+	fp.Close()
+
+	// A plain file named .gz, which was decoded while downloading.
+	plain := filepath.Join(dir, "plain.txt.gz")
+	if err = ioutil.WriteFile(plain, []byte(body), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, name := range []string{path, plain} {
+		if err = Extract(name, ArchiveGz, false); err != nil {
+			t.Errorf("Cannot decompress %v: %v", name, err)
+			continue
+		}
+		data, err := ioutil.ReadFile(strings.TrimSuffix(name, ".gz"))
+		if err != nil {
+			t.Error(err.Error())
+		} else if string(data) != body {
+			t.Errorf("Decompressed file is %q, want %q", string(data), body)
+		}
+		if _, err = os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("Compressed file %v isn't removed", name)
+		}
+	}
+
+}
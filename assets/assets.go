@@ -69,7 +69,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _assetsDockerfile = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x53\x5d\x8b\xdb\x46\x14\x7d\x9f\x5f\x71\xb0\x5f\x12\xf0\xca\x49\x0a\x2d\xa4\x21\x54\x5d\xdb\x89\x9a\x5d\xd9\xc8\x32\x8b\x09\x79\x18\x4b\x57\xd2\x74\xa5\x19\x75\xe6\xce\x0a\x63\xfc\xdf\xcb\xc8\x9b\x6e\x13\x96\xe4\x49\x9a\xfb\x75\xce\xb9\x1f\x53\x31\xc5\xc2\x14\xf7\x64\x2b\xd5\x92\x08\xcf\x6b\xd3\x1f\xad\xaa\x1b\xc6\x8b\xe2\x25\xde\xbc\x7a\xfd\xeb\xd5\x9b\x57\xaf\x7f\xc3\x5f\x5e\xf7\xa4\xf0\x49\x0e\xb2\x33\x6c\xc6\xd8\xbc\x51\x0e\x21\x13\xca\xa1\x97\x96\x61\x2a\x64\x46\x96\x8a\xf0\x8f\x27\x4f\xe8\xa4\x96\x35\xd9\x68\x0c\x7f\xce\x13\x32\x2b\x4b\x04\x67\x2a\x1e\xa4\xa5\xb7\x38\x1a\x8f\x42\x6a\x58\x2a\x95\x63\xab\x0e\x9e\x09\x8a\x21\x75\x39\x37\x16\x9d\x29\x55\x75\x14\xd3\x60\xf2\xba\x24\x0b\x6e\x08\x4c\xb6\x73\x01\x3e\x3c\x3e\xa4\x3b\x7c\x20\x4d\x56\xb6\xd8\xf8\x43\xab\x0a\xdc\xa8\x82\xb4\x23\x48\x87\x3e\x58\x5c\x43\x25\x0e\xa1\x4c\x48\x58\x05\x06\xdb\x47\x06\x58\x19\xaf\x4b\xc9\xca\xe8\x19\x48\x71\x43\x16\x0f\x64\x9d\x32\x1a\xbf\x7c\x85\x78\xac\x37\x83\xb1\x62\x8a\x17\x92\x03\x6d\x0b\xd3\x87\xb4\x97\x90\xfa\x88\x56\xf2\x53\xe6\x8f\x3b\xf0\x24\xb4\x84\xd2\x23\x40\x63\x7a\x02\x37\x92\x83\xce\x41\xb5\x2d\x0e\x04\xef\xa8\xf2\xed\x4c\x4c\x71\xf0\x8c\xbb\x24\xff\xb8\xde\xe5\x88\xd3\x3d\xee\xe2\x2c\x8b\xd3\x7c\xff\x3b\x06\xc5\x8d\xf1\x0c\x7a\xa0\x4b\x25\xd5\xf5\xad\xa2\x12\x83\xb4\x56\x6a\x3e\xc2\x54\x62\x8a\xdb\x65\x76\xfd\x31\x4e\xf3\xf8\xcf\xe4\x26\xc9\xf7\x30\x16\xab\x24\x4f\x97\xdb\x2d\x56\xeb\x0c\x31\x36\x71\x96\x27\xd7\xbb\x9b\x38\xc3\x66\x97\x6d\xd6\xdb\x65\x04\x6c\x29\x90\x22\x31\xfd\x51\x8f\xab\x71\x4a\x96\x50\x12\x4b\xd5\xba\x8b\xf6\xbd\xf1\x70\x8d\xf1\x6d\x89\x46\x3e\x10\x2c\x15\xa4\x1e\xa8\x84\x44\x61\xfa\xe3\xcf\x67\x27\xa6\x90\xad\xd1\xf5\xa8\xf0\xf9\x35\x43\x52\x41\x1b\x9e\xc1\x11\xe1\x5d\xc3\xdc\xbf\x9d\xcf\x87\x61\x88\x6a\xed\x23\x63\xeb\x79\x7b\x29\xe5\xe6\xef\x03\xa9\xaf\x2b\xcc\xd4\xf5\x61\x5a\x61\x14\x12\xe5\x7f\x07\x81\xa1\x51\x45\x03\xa5\x1d\xcb\xb6\x75\x90\x3d\xa3\x97\xc5\xbd\xac\x69\x14\xb5\xca\xd6\xb7\x38\x9d\xa2\xa4\x93\x35\x9d\xcf\xe2\x36\x4e\xd2\x3c\x4e\xd2\x65\xf6\xfd\xb9\xe0\xdd\xfd\xe3\x5f\xf4\xf7\xe8\xf9\xa3\xee\xa4\x6a\xa3\xc2\x74\xef\x03\x8d\xe4\x02\xf1\x0d\x02\x5c\x4f\x85\xaa\xd4\xd3\x4e\xb8\xc2\xaa\x9e\x2f\x17\xc7\x26\x2c\x84\xf5\x3a\x12\xa7\xd3\xd8\x91\x28\xde\xe4\xe7\xb3\xc8\x76\x69\x28\x73\x55\x13\xc3\xf7\xa5\x64\x12\xa7\x93\x95\xba\x26\x44\xdf\xb9\x1f\x85\xe1\xea\x18\x54\x9c\xcf\xe2\x74\x22\x5d\xfe\xef\x2b\xee\xd6\xd9\xa7\x45\x92\x61\x5e\x4a\x96\x22\x5e\x2c\x10\xd9\xb1\xf1\x73\xd2\x6c\x8f\xbd\x51\x9a\x23\xd7\x60\x6e\x8d\xe1\x6f\x6d\x62\x99\xe6\xd9\x7e\xb3\x4e\xd2\x1c\x9f\x27\x07\xe9\x9a\xc9\x0c\x93\x67\x02\x27\x5f\xc4\xf5\xed\x02\x9f\x27\x93\x2f\xe2\xdf\x00\x00\x00\xff\xff\x36\x04\xed\x4d\x91\x04\x00\x00")
+var _assetsDockerfile = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x53\x5d\x6f\xdb\x36\x17\xbe\xd7\xaf\x78\x10\xdf\xb4\x40\x22\xb7\x7d\x81\x77\x40\x57\x14\xd3\xd2\xb8\xd5\x9a\xc8\x86\x2c\x23\x30\x86\x5d\x1c\x4b\x47\x12\x17\x89\x54\xc9\xc3\x08\x86\x90\xff\x3e\x50\x76\x97\xad\x28\xba\x2b\x89\xe4\xf9\x78\x3e\xce\x59\x44\x0b\x7c\x30\xe5\x03\xdb\x5a\x75\x1c\x85\xe3\xb5\x19\x8e\x56\x35\xad\xe0\x45\xf9\x12\x6f\x5e\xbd\xfe\xff\xd5\x9b\x57\xaf\x7f\xc2\x6f\x5e\x0f\xac\xf0\x99\x46\xea\x8d\x98\x39\xb6\x68\x95\x43\xc8\x84\x72\x18\xc8\x0a\x4c\x8d\xdc\x50\xa5\x18\x5f\x3c\x7b\x46\x4f\x9a\x1a\xb6\xf1\x1c\xfe\xbd\x97\x90\x59\x5b\x66\x38\x53\xcb\x48\x96\xdf\xe2\x68\x3c\x4a\xd2\xb0\x5c\x29\x27\x56\x1d\xbc\x30\x94\x80\x74\xb5\x34\x16\xbd\xa9\x54\x7d\x8c\x16\xe1\xca\xeb\x8a\x2d\xa4\x65\x08\xdb\xde\x85\xf6\xe1\xf0\x31\xdb\xe1\x23\x6b\xb6\xd4\x61\xe3\x0f\x9d\x2a\x71\xab\x4a\xd6\x8e\x41\x0e\x43\xb8\x71\x2d\x57\x38\x84\x32\x21\x61\x15\x10\x6c\xcf\x08\xb0\x32\x5e\x57\x24\xca\xe8\x4b\xb0\x92\x96\x2d\x1e\xd9\x3a\x65\x34\xfe\xf7\xb5\xc5\xb9\xde\x25\x8c\x8d\x16\x78\x41\x12\x60\x5b\x98\x21\xa4\xbd\x04\xe9\x23\x3a\x92\xe7\xcc\x1f\x2b\xf0\x4c\xb4\x82\xd2\x33\xa1\xd6\x0c\x0c\x69\x49\x02\xcf\x51\x75\x1d\x0e\x0c\xef\xb8\xf6\xdd\x65\xb4\xc0\xc1\x0b\xee\xd3\xe2\xd3\x7a\x57\x20\xc9\xf6\xb8\x4f\xf2\x3c\xc9\x8a\xfd\xcf\x18\x95\xb4\xc6\x0b\xf8\x91\x4f\x95\x54\x3f\x74\x8a\x2b\x8c\x64\x2d\x69\x39\xc2\xd4\xd1\x02\x77\x37\xf9\xf5\xa7\x24\x2b\x92\x5f\xd3\xdb\xb4\xd8\xc3\x58\xac\xd2\x22\xbb\xd9\x6e\xb1\x5a\xe7\x48\xb0\x49\xf2\x22\xbd\xde\xdd\x26\x39\x36\xbb\x7c\xb3\xde\xde\xc4\xc0\x96\x03\x28\x8e\x16\x3f\xd2\xb8\x9e\x5d\xb2\x8c\x8a\x85\x54\xe7\x4e\xdc\xf7\xc6\xc3\xb5\xc6\x77\x15\x5a\x7a\x64\x58\x2e\x59\x3d\x72\x05\x42\x69\x86\xe3\x7f\x7b\x17\x2d\x40\x9d\xd1\xcd\xcc\xf0\xbb\x52\xc6\x48\x6b\x68\x23\x97\x70\xcc\x78\xd7\x8a\x0c\x6f\x97\xcb\x71\x1c\xe3\x46\xfb\xd8\xd8\x66\xd9\x9d\x6c\x73\xcb\xf7\x01\xd4\xd7\x11\x16\xee\x87\xe0\x56\xb0\x82\x50\xfd\xbd\x10\x18\x5b\x55\xb6\x50\xda\x09\x75\x9d\x03\x0d\x82\x81\xca\x07\x6a\x78\x26\xb5\xca\xd7\x77\x98\xa6\x38\xed\xa9\xe1\xa7\xa7\xe8\x2e\x49\xb3\x22\x49\xb3\x9b\xfc\xdb\x75\xc1\xbb\x87\xf3\x5f\xfc\xe7\xfc\xf2\x4b\xd3\x93\xea\xe2\xd2\xf4\xef\xa3\x68\x81\xf4\xd4\xe2\x5f\x1d\xe0\x06\x2e\x55\xad\x9e\x67\xc2\x95\x56\x0d\x72\xda\x38\x31\x61\x20\xac\xd7\x71\x34\x4d\xb3\x22\x71\xb2\x29\x9e\x9e\xa2\x7c\x97\x85\x32\x57\x0d\x0b\xfc\x50\x91\x70\x34\x4d\x96\x74\xc3\x88\xbf\x79\x3e\x13\xc3\xd5\x11\xd3\xf4\xc5\x1b\x39\x85\x4c\x13\xeb\xea\x1f\xdf\x59\x26\x06\x6b\xb1\xc7\xc1\x28\x2d\x41\xa7\xde\x78\x1d\xc6\x75\x6c\x59\xcf\x16\x6a\x21\xa5\xd9\xc2\x7a\xed\xe0\xcc\x79\x76\x83\x32\x6e\x5e\xe7\x03\xc3\xb5\x64\xb9\x0a\x3e\xf6\x46\x37\x10\x72\x0f\x2e\x8e\xee\xd7\xf9\xe7\x0f\x69\x8e\x65\x45\x42\xd1\x4d\x56\xe4\xfb\xcd\x3a\xcd\x0a\xfc\x7e\x71\x20\xd7\x5e\x5c\xe2\x62\x69\x67\xb7\x97\xcf\x10\x62\xd7\x5e\xfc\x11\xfd\x35\x00\xc1\x69\x43\x55\xc0\x04\x00\x00")
 
 func assetsDockerfileBytes() ([]byte, error) {
 	return bindataRead(
@@ -89,7 +89,7 @@ func assetsDockerfile() (*asset, error) {
 	return a, nil
 }
 
-var _assetsEntrypointSh = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xcc\x95\xdf\x4f\x1b\x47\x10\xc7\xdf\xef\xaf\xf8\x06\x5b\x09\x54\xdc\x39\xa4\x0f\x95\x48\x41\x75\x1d\x20\x6e\x5d\x82\x6c\xa3\x88\x46\x51\xb4\xbe\x9b\xbb\x5b\x65\xbd\xbb\xd9\x1f\x18\x73\xf5\xff\x5e\xed\xdd\xf9\x07\x04\xd1\xaa\x4f\x7d\x82\x9d\x9d\xf9\xcc\xcc\xce\xf7\xc6\x9d\x17\xbd\x19\x97\xbd\x19\xb3\x65\xd4\x89\x3a\x20\xe9\xcc\x52\x2b\x2e\x5d\xd2\x5a\x06\x4a\x2f\x0d\x2f\x4a\x87\xfd\xf4\x00\x6f\x5e\x1f\xfd\x84\xdf\xbc\xd4\xc4\xf1\x3b\x5b\xb0\xb9\x72\xaa\x76\x9b\x96\xdc\x22\xe7\x82\xc0\x2d\x34\x33\x0e\x2a\xc7\x58\xb1\x8c\x13\xbe\x79\xf2\x84\x39\x93\xac\x20\x93\xd4\xee\x4f\xdd\x84\xc8\xdc\x10\xc1\xaa\xdc\x2d\x98\xa1\x63\x2c\x95\x47\xca\x24\x0c\x65\xdc\x3a\xc3\x67\xde\x11\xb8\x03\x93\x59\x4f\x19\xcc\x55\xc6\xf3\x65\xd4\x09\x26\x2f\x33\x32\x70\x25\xc1\x91\x99\xdb\x90\x3e\x1c\x2e\x2e\xaf\x71\x41\x92\x0c\x13\xb8\xf2\x33\xc1\x53\x8c\x78\x4a\xd2\x12\x98\x85\x0e\x16\x5b\x52\x86\x59\xc0\x84\x80\xf3\x50\xc1\xa4\xad\x00\xe7\xca\xcb\x8c\x39\xae\xe4\x21\x88\xbb\x92\x0c\x6e\xc9\x58\xae\x24\x7e\x5c\xa7\x68\x79\x87\x50\x26\xea\x60\x9f\xb9\x50\xb6\x81\xd2\x21\xec\x00\x4c\x2e\x21\x98\xdb\x46\x3e\xff\x02\xdb\x46\x33\x70\x59\x27\x28\x95\x26\xb8\x92\xb9\xd0\xe7\x82\x0b\x81\x19\xc1\x5b\xca\xbd\x38\x8c\x3a\x98\x79\x87\x8f\xc3\xe9\xfb\x0f\xd7\x53\xf4\x2f\x6f\xf0\xb1\x3f\x1e\xf7\x2f\xa7\x37\x6f\xb1\xe0\xae\x54\xde\x81\x6e\xa9\x21\xf1\xb9\x16\x9c\x32\x2c\x98\x31\x4c\xba\x25\x54\x1e\x75\xf0\xc7\xd9\x78\xf0\xbe\x7f\x39\xed\xff\x3a\x1c\x0d\xa7\x37\x50\x06\xe7\xc3\xe9\xe5\xd9\x64\x82\xf3\x0f\x63\xf4\x71\xd5\x1f\x4f\x87\x83\xeb\x51\x7f\x8c\xab\xeb\xf1\xd5\x87\xc9\x59\x02\x4c\x28\x14\x45\x51\xe7\xb9\x37\xce\xeb\x29\x19\x42\x46\x8e\x71\x61\x9b\xde\x6f\x94\x87\x2d\x95\x17\x19\x4a\x76\x4b\x30\x94\x12\xbf\xa5\x0c\x0c\xa9\xd2\xcb\x7f\x9e\x5d\xd4\x01\x13\x4a\x16\x75\x87\x4f\xcb\x0c\xc3\x1c\x52\xb9\x43\x58\x22\xfc\x5c\x3a\xa7\x8f\x7b\xbd\xc5\x62\x91\x14\xd2\x27\xca\x14\x3d\xd1\xa0\x6c\xef\x34\x14\xb5\x96\xb0\xa3\xb9\x0e\xd3\x0a\xa3\x60\x72\xe7\x7b\x08\x45\x31\x64\x2a\xfd\x4a\x06\xa9\x92\x8e\x71\x19\x04\xa7\x40\x77\x94\x06\x5d\x1a\x2f\x61\x1d\xe9\xba\x49\x9e\xe3\xd3\x27\x74\x3b\x78\x71\x82\xd7\xf8\xfc\xf9\x6d\xe8\x48\x46\xa8\xbd\xd1\xfd\x25\xca\x79\x14\xd1\x9d\x33\x2c\x75\x5f\xee\xb9\xde\x3f\xa8\xc2\x65\x5a\x2a\xec\x5d\xcb\x7b\xae\x35\x97\x05\xba\x47\x7b\x11\xe0\xc3\x19\xb1\x42\x9c\xa1\xbb\x9f\x71\x23\xd9\x9c\xd0\x3d\x3a\x40\xf7\x28\x02\xcc\x3c\xfc\x5d\x45\x91\x97\x9a\xa5\x5f\xbf\x38\x66\x8a\xfb\x87\xbc\x60\xdf\xf2\xf6\xd3\xc7\x9c\x97\x2f\xe1\x98\x41\x7c\x7f\x77\x9b\x07\xc3\xd3\xd4\xff\xc6\x7c\x02\x59\x55\xf5\xdc\x92\x0b\xee\x56\xab\x0d\x72\x20\x94\x0c\xc0\x82\x3b\x18\xd2\xca\x72\xa7\xcc\x12\x55\x95\xac\x56\x21\x45\xb0\xa7\x42\x49\x6a\x4c\x48\xa2\xaa\x22\x99\xad\x6a\xa0\x61\xb2\x20\x24\xef\xd4\x42\x0a\xc5\x32\xbb\xc3\x5d\xdb\x02\xbb\xaa\x92\x89\x49\x1b\x5e\x3b\xa2\xfd\xd4\x1b\x81\x78\x88\xf8\x3d\x5e\xf5\xd3\x94\xb4\x8b\xcf\x64\xaa\x82\xff\x31\x8a\x7b\xae\x0f\x33\xca\x83\x26\x5e\x6d\xc2\xf1\xe6\xb4\x97\xd1\x6d\x4f\x7a\x21\xf0\x17\x0a\x43\x1a\x7b\x03\x25\x1d\xc9\x6d\xf0\xde\xe6\x26\x40\xc2\x69\x91\x22\x16\x07\x38\x39\xc1\xd1\xae\x24\x80\xa6\x84\x51\x98\x71\xcf\xcd\x75\x2f\x04\x68\xca\xea\x7d\xba\xce\x59\x3b\x16\xb5\x12\xb2\x74\xc7\x6d\xed\x77\x1a\x3c\xdf\x91\x6d\x9f\x54\x58\x7a\x8c\xde\xdc\xef\x32\x73\x1e\x01\x55\xc5\x73\x24\x7f\x72\xdd\xa6\xd9\x11\xe6\x03\x6a\x55\x05\x6e\x78\xb9\x64\xca\xcc\xc5\x7d\xeb\xbe\x2b\xbc\x67\xfc\xbf\xf3\x7e\xec\x5b\x0f\xf3\xfb\xa1\x5e\x4c\xce\xb9\xa0\x7f\x33\xd2\xc2\x7a\xc7\x05\x52\xbd\x9d\xd4\xc3\x14\xff\xc3\x36\x1b\x19\xc6\x61\x0b\x7e\xf3\xdc\xd0\x9c\xa4\xb3\x89\xbb\x73\x0f\xb6\x46\xdd\xf6\x50\x5a\xc7\x84\x08\x5d\xb7\xce\x19\xf4\xd2\x95\x4a\x22\xe4\x62\x05\x59\x64\x94\x73\xd9\xfc\x76\x3c\x06\x86\x17\xd2\x5c\x83\x37\x18\xc4\x31\xdd\x71\xeb\x6c\xcc\xd2\xf0\x53\x05\x8e\xd8\x7c\x17\xd4\x2e\x2a\xad\x8c\xc3\x68\xf0\xa5\x3f\x1a\x9d\x0c\xa2\xa6\x9c\xb1\x97\xf5\x07\x9b\xaa\xf9\x9c\xc9\xcc\xd6\x39\xc3\x12\xa4\x9a\xb7\xb7\x99\x60\x97\xcb\x8c\xee\x0e\xd1\x25\xd1\x80\x71\x7c\x82\x64\xec\xe5\x6a\xd5\xa2\xda\x8f\xdc\x96\x88\xd3\xf5\x09\xa7\x8d\xca\xad\xcb\x94\x77\x55\xd5\x50\x56\xab\xba\xaa\xcd\xf3\xb5\xeb\x48\xaf\xe5\xd0\x78\xdb\x90\xbc\x6b\xc8\x7a\xe1\x9a\x64\xf5\xbf\xab\x55\xd4\x4a\x24\x9e\x07\x95\xec\xed\x24\xf8\xa1\x7e\x22\x6c\xc2\xea\x19\xb5\x0a\x6c\xf0\xbb\x0a\xdc\x26\xdc\xee\xa7\x07\xe4\xb6\x87\x87\xb8\xa6\xe6\xbf\x03\x00\x00\xff\xff\x3b\x40\xb0\xba\x75\x09\x00\x00")
+var _assetsEntrypointSh = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x56\x6b\x6f\xe3\xb8\x15\xfd\xae\x5f\x71\xc6\xf6\x00\xc9\x62\xa4\xcc\x6c\x0b\x14\x98\xa9\xdb\xba\x79\x4c\xdc\xc9\x24\x81\xed\x60\x31\x58\x2c\x02\x5a\xba\xb2\x88\x48\x24\x87\xa4\xe2\x18\x86\xfe\x7b\x41\xea\x61\x25\x76\xd2\xee\xa7\x58\xcc\x7d\x9c\x7b\xee\xe1\xbd\x1c\xbe\x3b\x59\x72\x71\xb2\x64\x26\x0b\x86\xc1\x10\x24\xac\xde\x28\xc9\x85\x8d\x9a\x93\x53\xa9\x36\x9a\xaf\x32\x8b\xa3\xf8\x18\xbf\x7e\xfc\xf4\x37\xfc\xa7\x14\x8a\x38\xbe\xb1\x35\x2b\xa4\x95\xde\x6c\x91\x71\x83\x94\xe7\x04\x6e\xa0\x98\xb6\x90\x29\x66\x92\x25\x9c\xf0\xb3\xa4\x92\x50\x30\xc1\x56\xa4\x23\x6f\x7e\xe8\x3f\xce\x33\xd5\x44\x30\x32\xb5\x6b\xa6\xe9\x33\x36\xb2\x44\xcc\x04\x34\x25\xdc\x58\xcd\x97\xa5\x25\x70\x0b\x26\x92\x13\xa9\x51\xc8\x84\xa7\x9b\x60\xe8\x8e\x4a\x91\x90\x86\xcd\x08\x96\x74\x61\x5c\x7a\xf7\xf1\xf5\xfa\x0e\x5f\x49\x90\x66\x39\x6e\xcb\x65\xce\x63\x5c\xf1\x98\x84\x21\x30\x03\xe5\x4e\x4c\x46\x09\x96\x2e\x8c\x73\xb8\x70\x08\xe6\x0d\x02\x5c\xc8\x52\x24\xcc\x72\x29\x3e\x80\xb8\xcd\x48\xe3\x91\xb4\xe1\x52\xe0\x2f\x6d\x8a\x26\xde\x07\x48\x1d\x0c\x71\xc4\xac\x83\xad\x21\x95\x73\x3b\x06\x13\x1b\xe4\xcc\xee\x3c\xdf\x66\x60\x57\x68\x02\x2e\x7c\x41\x99\x54\x04\x9b\x31\xeb\xea\x5c\xf3\x3c\xc7\x92\x50\x1a\x4a\xcb\xfc\x43\x30\xc4\xb2\xb4\xf8\x6d\xba\xb8\xbc\xb9\x5b\x60\x72\xfd\x03\xbf\x4d\x66\xb3\xc9\xf5\xe2\xc7\x17\xac\xb9\xcd\x64\x69\x41\x8f\x54\x47\xe2\x85\xca\x39\x25\x58\x33\xad\x99\xb0\x1b\xc8\x34\x18\xe2\xfb\xf9\xec\xf4\x72\x72\xbd\x98\xfc\x7b\x7a\x35\x5d\xfc\x80\xd4\xb8\x98\x2e\xae\xcf\xe7\x73\x5c\xdc\xcc\x30\xc1\xed\x64\xb6\x98\x9e\xde\x5d\x4d\x66\xb8\xbd\x9b\xdd\xde\xcc\xcf\x23\x60\x4e\x0e\x14\x05\xc3\xb7\x38\x4e\x7d\x97\x34\x21\x21\xcb\x78\x6e\xea\xda\x7f\xc8\x12\x26\x93\x65\x9e\x20\x63\x8f\x04\x4d\x31\xf1\x47\x4a\xc0\x10\x4b\xb5\xf9\xdf\xbd\x0b\x86\x60\xb9\x14\x2b\x5f\xe1\x41\x2a\x23\x4c\x53\x08\x69\x3f\xc0\x10\xe1\xef\x99\xb5\xea\xf3\xc9\xc9\x7a\xbd\x8e\x56\xa2\x8c\xa4\x5e\x9d\xe4\x75\xdb\xcc\xc9\x3f\x1c\xa8\x56\xc2\x96\x0a\xe5\xba\xe5\x5a\xc1\x44\xef\x3e\x38\x50\x0c\x89\x8c\x1f\x48\x23\x96\xc2\x32\x2e\x9c\xe0\x24\xe8\x89\x62\xa7\x4b\x5d\x0a\x18\x4b\xca\x15\x89\x5b\x66\x33\xe3\xfa\xb5\xf2\x05\x58\x32\x70\x7a\xfa\x59\x4a\xd7\xd8\xe5\xc6\x17\xa8\x98\xcd\x90\x96\x22\x76\x4a\xf9\x80\x75\xc6\xe3\x0c\x4a\x53\xca\x9f\x9c\xfd\xd2\xc8\xbc\xb4\x8e\x61\x67\x68\xea\x62\x47\xb3\x9b\xc9\xd9\xf4\xfc\x7e\x76\x73\xb3\xf8\xe2\x12\x70\x03\x2a\x94\xdd\x38\xb5\x74\xb8\x1c\x86\x80\xa7\xf8\xfd\x77\x8c\x86\x78\x37\xc6\x47\xfc\xf1\xc7\x17\x97\x54\x04\xf0\x88\x31\x18\xfd\x6b\x10\xa4\x3c\x08\xb6\x5b\xcd\xc4\x8a\x10\xcd\x29\xd6\x64\xcf\xc5\xa3\xa9\x2a\x6f\xa5\xa4\xb6\xd8\x6e\xa3\x6b\x56\x50\x55\x8d\x07\xa3\xa3\x98\xb9\x03\x07\x07\x91\x2b\xb1\xaa\x8e\x07\xc1\x76\x4b\x22\xa9\x2a\x17\xc9\x43\x8c\xbe\x72\x5b\x47\x88\x33\x89\xc1\x69\x2e\x05\x17\x2b\xac\xb8\x85\x26\x25\x0d\xb7\x52\x6f\x06\xd8\x6e\x3d\x1b\x88\xee\x66\x57\xde\xbc\x75\x3f\x23\x95\xcb\xcd\x37\xda\xf8\xd3\x0e\xc8\xd7\xe9\xe2\x7e\x3e\xbf\xbc\x3f\xbd\xf9\xfe\x7d\x72\x7d\x36\x6e\xfd\x8f\x94\xe6\xc2\xa6\x18\x18\x93\x21\xe4\x78\x6f\x10\x4a\x4c\x13\x12\x96\x5b\x4e\xe6\x46\xe4\x9b\xf1\x86\xfc\xe9\x9d\x21\xfd\x4d\xc8\xb5\xb8\x94\xc6\x9a\x0b\x9e\xd3\xb8\x36\x9f\x5b\xcd\x63\xeb\x4e\xbf\xd1\xe6\x34\xa3\xf8\x81\x8b\x95\xf3\x1a\xe0\xa8\x2e\xf7\xb8\xf9\x31\x72\xe5\x45\xbb\x20\xc7\xc7\x0d\xf8\x9a\x84\xae\x8c\x51\x74\xaa\xc9\x83\x60\xb9\x69\x2a\x71\x14\xc4\x52\xa4\x7c\x85\x30\x5c\xe5\x72\xc9\x72\xc4\x9d\x55\x94\x51\xae\x48\x63\xaf\xb0\x77\xef\x4d\xcf\x0c\xa1\x20\xab\x63\xbc\xef\xb0\x8d\xa2\x4b\xef\xd9\x42\x8c\x0e\x60\xe2\xa9\x9b\x9a\x88\x4e\x65\x51\x70\xeb\x49\xb6\x59\x0f\x16\x17\xdc\x76\x1f\x9a\x0a\xc7\x2c\x4b\x12\x48\xcd\x57\x5c\xec\x37\xab\x2e\x26\x25\x1b\x67\x08\xc3\x84\x94\xcd\x9c\x54\x9a\xb0\x7b\x6e\x75\xda\x9e\x67\xec\x38\x76\xc3\xe9\xe2\x7c\x71\x7a\x79\x7f\x79\x3e\x39\xf3\x38\x29\x37\x04\x9e\x1e\xf2\xc8\xa5\xa0\x17\x40\x10\xed\x07\x3c\x94\xb3\x8e\x7b\x20\x58\xa7\x38\x47\x46\xaf\x8e\xaa\x6a\xd9\x6b\x6d\x66\x94\x3a\x8b\xa5\x66\x22\xce\x76\x49\xfa\x86\x7b\xc8\x5e\x34\x20\x9a\x97\xcb\x42\x26\x65\x4e\x7d\x41\x98\xf6\x10\xa5\x4a\xdc\xe8\x09\x43\xd7\x0c\x84\xa1\xa6\xb8\xd4\x86\x3f\xd2\x0b\x9c\x7d\xc2\xab\xaa\x9f\xa4\xfe\xd5\xfe\xdd\x5d\xed\x33\xb9\x16\xb9\x64\x89\x69\xec\x9e\xc9\xa6\xaa\x90\x34\xff\x7f\x45\xbc\x8d\xe2\xda\x9b\xbf\x4f\xce\x85\xd4\x05\xb3\x55\x15\xa6\xfe\x47\x47\x4f\x7d\x37\x11\x1d\xf7\x5d\x1c\x13\xdf\x88\x54\x55\x85\x0f\x44\x6a\x8f\xbf\xb9\x8e\xbd\x79\x9d\xec\x8c\x8c\x3d\x54\xd3\x28\xc9\xf1\x79\x8c\xe8\xeb\xdc\x5d\xe3\x66\x64\xf9\x81\xd3\x16\xcb\xc5\xaa\x37\x65\x7c\xd4\x00\x58\x99\xd2\xf2\x1c\xb1\xc2\xdb\x09\x81\x97\xc5\x79\xf1\xec\x73\x47\x4f\x56\xb3\xd8\xe2\xed\xda\x79\x8a\x51\x92\x1f\xae\xbb\x8e\x98\xe4\xfd\xd4\x7b\x9d\xac\xb1\xcc\xc9\x96\xea\x8c\x6b\x8f\xa6\x14\x86\xf6\xe6\x62\xff\xb6\xfb\x59\xf5\xb2\x99\xaf\x4e\xa2\x30\xac\x03\xee\x4d\xa4\x1e\x20\x40\x17\x08\x75\xda\xb1\x55\x55\x27\xbf\xec\x60\xd6\x2b\x27\x74\x2b\xfd\x67\xc9\x35\x15\x24\xac\x89\xec\x93\x7d\xb6\x7e\x7c\x97\xa6\xc2\x58\x96\xe7\x6e\x33\x34\xc6\x09\xd4\xc6\x66\x52\x40\xb1\xf8\x81\xad\xc8\x20\xa1\x94\x8b\xfa\x21\xf4\x32\xe0\x20\x00\x14\x57\xe0\x75\x18\x84\x21\x3d\x71\x63\x4d\xc8\xfc\x36\x05\x47\xa8\xf7\x50\xf8\x7d\x37\x84\xb1\xcc\x96\xc6\xad\x78\xb7\x85\xe9\x89\xdb\xf6\xa8\x79\x79\xa4\x5c\x1b\x8b\x94\xf1\x9c\x12\xbf\xd3\xbf\x40\x53\xc1\xb8\xdf\x63\xee\xdb\x6f\xf3\x60\x08\xf3\xc0\x95\x72\x0f\x97\xd4\x3d\xf0\x98\xb7\x85\xe5\x05\x19\xc8\xd2\xba\x27\xa1\x7f\xff\xf9\x63\x17\xce\xb8\xd1\x66\xac\x54\xf7\x52\xdc\xbb\x83\x52\xfb\x17\xb3\x21\x1b\x05\x35\x86\xf1\xc7\xc0\x19\x28\x4a\xc6\x1f\x83\x9a\xaa\x59\x29\x7c\xe6\x58\x16\x05\x13\x89\xf1\x7c\xb8\xd7\x06\xf9\x5a\x07\xbb\x7b\x3e\x2b\x45\x55\xb5\x8b\xbf\x09\x83\xf1\xcb\xf5\xef\x82\xee\xc4\x5f\x16\x05\xd3\x9b\x46\x76\x7e\x68\x32\x91\x5c\x71\x41\x3d\x91\x07\x40\x2c\x13\x1a\x8f\xfe\x19\x00\x5d\x78\x07\x77\x2f\x3a\x1a\x2e\xc7\x23\xe7\x11\x00\x29\x6f\x25\x39\x8a\xe6\x56\xaa\x1b\x71\x51\x17\xde\x48\xb1\x09\xe7\xac\xf7\x5e\x2a\x4e\xaa\x2d\x1b\x9f\xfc\x77\xca\x9f\xaf\x89\x05\x2f\x48\x96\xf6\x40\xac\xf1\x18\x9f\x7e\xfd\xeb\xcb\x68\x35\xa3\x73\x4b\xaa\x37\x1b\xea\x07\x0e\x06\xae\x73\x89\xeb\xdc\xe0\xcd\xdc\x5e\xeb\x29\xdf\xbf\x9d\xfd\xd2\x9e\xb3\xb4\xf7\x04\x7b\xb5\xb1\x3d\x61\x74\xfd\x05\xba\x0e\x37\x85\xbe\xde\xc3\xb7\xbb\xf8\x16\xfa\x0b\x2e\x58\x9e\xbb\x28\xaf\xcb\x2e\xad\x6d\x0e\x48\x6f\x37\x80\xff\xa4\xb4\x5a\x1c\x1d\x9e\x3a\xfb\x9d\x6a\x66\x38\x72\xb9\x32\x2e\xd1\x48\x93\x29\x73\xeb\xa7\xfe\xcc\xff\xec\x68\x0e\x93\x6e\x20\x5d\xc9\x95\x9f\x8f\x7d\xb6\xfd\xf8\x95\xba\x7d\xe2\xfa\x85\x81\xe8\x3b\x33\x0f\x67\x7c\x45\xc6\xb6\x53\xb1\x89\xb1\x03\x87\x82\x99\x87\x1d\xf9\x3d\xf7\xaa\x0a\x8d\xff\x7a\x63\x2b\xba\x04\x73\x96\xbb\xbd\x68\x58\xde\x7b\x99\xf4\x4d\x9b\xd0\xcf\xc0\x84\x89\x87\x75\xd8\xa1\x81\xd8\xd6\xd9\x6b\x6a\xb7\xdc\xc2\xa2\xde\x6f\xcf\x19\x19\x9c\xfc\xb2\xd3\x7c\x43\x66\x2b\x85\xf6\x79\xf8\xec\x82\xe2\x48\x48\x8b\xa8\xee\x44\x77\x7a\xfc\x7f\x8a\x7b\xfe\xc0\x15\xca\xae\x8b\x75\x3e\x03\xc3\x45\x4c\xed\xa8\x74\x23\x90\x12\x77\xdb\xfc\x14\x6e\x02\xf6\xd5\xd9\x11\x54\xa3\xe8\xef\xf9\x4e\x21\xbd\x9b\xfc\x3a\x0b\x55\x75\xa0\xf6\x5d\x16\x9e\xbe\x28\xde\x5d\x83\x3e\xa6\xed\x96\x44\x52\x55\xc1\x7f\x07\x00\x3b\x9b\x4c\x86\x33\x11\x00\x00")
 
 func assetsEntrypointShBytes() ([]byte, error) {
 	return bindataRead(
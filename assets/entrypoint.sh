@@ -21,61 +21,59 @@
 #
 
 # This template is an entrypoint of a docker container to execute run steps.
+# Paths it generates are quoted by the path function, which prefixes absolute
+# paths with $ROADIE_ROOT; it is empty in containers.
 #
 if [[ $# != 0 ]]; then
-  exec $@
+  exec "$@"
 fi
 
-extract_zip(){
-  echo "Unzipping $1"
-  unzip -o -d $(dirname $1) $1
-  rm $1
-}
-
-unpack_targz(){
-  echo "Unpacking $1"
-  (cd $(dirname $1) && tar -zxvf $1)
-  rm $1
-}
-
-unpack_tar(){
-  echo "Unpacking $1"
-  (cd $(dirname $1) && tar -xvf $1)
-  rm $1
-}
+{{range .SecretEnvs}}
+  export {{.Name}}="$(cat {{path .Path}})"
+{{end}}
 
 {{with .Git}}
-  echo "Cloning git repository {{.}}"
-  git clone {{.}} .
+  echo "Cloning git repository" {{quote .URL}}
+  {{with .DeployKey}}
+    export GIT_SSH_COMMAND={{quote (printf "ssh -i %s -o IdentitiesOnly=yes -o UserKnownHostsFile=%s -o StrictHostKeyChecking=yes" (path .) (path $.Git.KnownHosts))}}
+  {{end}}
+  {{with $.Credentials}}
+    git config --global credential.helper {{quote (printf "!%s credential -netrc %s" (path $.Helper) (path .))}}
+  {{end}}
+  {{if and .Commit .Depth}}
+    git init
+    git remote add origin {{quote .URL}}
+    git fetch --depth {{.Depth}} origin {{quote .Commit}}
+    git checkout FETCH_HEAD
+  {{else if .Commit}}
+    git clone {{quote .URL}} .
+    git checkout {{quote .Commit}}
+  {{else}}
+    git clone {{with .Depth}}--depth {{.}} {{end}}{{with .Ref}}--branch {{quote .}} {{end}}{{quote .URL}} .
+  {{end}}
+  {{if .Submodules}}
+    git submodule update --init --recursive{{with .Depth}} --depth {{.}}{{end}}
+  {{end}}
 {{end}}
 
 {{range .Downloads}}
-  echo "Downloading {{.Src}}"
-  if [[ $(curl -I -H 'Accept-Encoding: gzip,deflate' {{.Src}} 2>/dev/null | grep "Content-Encoding" | grep "gzip" | wc -l) == 1 ]]; then
-    curl -L -o /tmp/gzippedfile {{.Src}}
-    gzip -dc /tmp/gzipppedfile > {{.Dest}}
-  else
-    curl -L -o {{.Dest}} {{.Src}}
-  fi
-  {{if .Zip}}
-    extract_zip {{.Dest}}
-  {{else if .TarGz}}
-    unpack_targz {{.Dest}}
-  {{else if .Tar}}
-    unpack_tar {{.Dest}}
+  {{path $.Helper}} download {{with $.Credentials}}-netrc {{path .}} {{end}}{{with .Format}}-format {{quote (print .)}} {{end}}{{if .Keep}}-keep {{end}}{{quote .Src}} {{path .Dest}}
+{{end}}
+
+{{range $dl := .GSFiles}}
+  echo "Downloading" {{quote .Src}}
+  gsutil cp {{quote .Src}} {{path .Dest}}
+  {{with .Format}}
+    {{path $.Helper}} extract -format {{quote (print .)}} {{if $dl.Keep}}-keep {{end}}{{path $dl.Dest}}
   {{end}}
 {{end}}
 
-{{range .GSFiles}}
-  echo "Downloading {{.Src}}"
-  gsutil cp {{.Src}} {{.Dest}}
-  {{if .Zip}}
-    extract_zip {{.Dest}}
-  {{else if .TarGz}}
-    unpack_targz {{.Dest}}
-  {{else if .Tar}}
-    unpack_tar {{.Dest}}
+{{with .SetupDir}}
+  unset GIT_SSH_COMMAND
+  {{if and $.Git $.Credentials}}
+    git config --global --unset credential.helper
   {{end}}
+  rm -rf {{path .}}/*
 {{end}}
 
 if [[ -e requirements.txt ]]; then
@@ -83,17 +81,68 @@ if [[ -e requirements.txt ]]; then
   pip install --exists-action i -r requirements.txt
 fi
 
-export LC_ALL=C
+# status is the exit status of the first failed step; remaining steps are
+# skipped after a step times out, or any step fails if stop_on_failure is set.
+status=0
+stopped=0
 echo "Running commands in run section"
-{{range $index, $elements := .Run}}
-echo "{{.}}"
-sh -c "{{.}}" > /tmp/stdout{{$index}}.txt
+{{range .Run}}
+if [[ $stopped == 0 ]]; then
+  echo {{quote .Summary}}
+  {{.CommandLine $.Helper}}
+  code=$?
+  if [[ $status == 0 ]]; then
+    status=$code
+  fi
+  {{if $.StopOnFailure}}
+    if [[ $code != 0 ]]; then
+      stopped=1
+    fi
+  {{else if .Timeout}}
+    if [[ $code == 124 ]]; then
+      echo "Step" {{quote .Name}} "timed out"
+      stopped=1
+    fi
+  {{end}}
+fi
 {{end}}
 
-echo "Uploading stdouts"
+{{with .OnFailure}}
+if [[ $status != 0 ]]; then
+  echo "Running commands in on_failure section"
+  {{range .}}
+    echo {{quote .Summary}}
+    {{.CommandLine $.Helper}}
+  {{end}}
+fi
+{{end}}
+
+{{with .Finally}}
+echo "Running commands in finally section"
+{{range .}}
+  echo {{quote .Summary}}
+  {{.CommandLine $.Helper}}
+{{end}}
+{{end}}
+
+echo "Uploading logs"
 {{$result := .Result}}
-gsutil -m cp "/tmp/stdout*.txt" {{$result}}
+if [[ -d {{path .LogDir}} ]]; then
+  {{if or .SecretFiles .MaskDigests}}
+    {{path $.Helper}} mask {{range .SecretFiles}}-secret {{path .}} {{end}}{{with .MaskSalt}}-salt {{quote .}} {{end}}{{range .MaskDigests}}-digest {{quote .}} {{end}}{{path $.LogDir}}
+  {{end}}
+  gsutil -m cp {{path .LogDir}}"/*" {{quote $result}}
+fi
+{{if and .StopOnFailure (not .UploadOnFailure)}}
+if [[ $status != 0 ]]; then
+  echo "Skip uploading results since a step failed"
+  exit $status
+fi
+{{end}}
 {{range .Uploads}}
-  echo "Uploading {{.}}"
-  gsutil -m cp "{{.}}" {{$result}}
+  echo "Uploading" {{quote .}}
+  gsutil -m cp {{path .}} {{quote $result}}
+{{end}}
+{{if .StopOnFailure}}
+exit $status
 {{end}}
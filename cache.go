@@ -0,0 +1,141 @@
+//
+// cache.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// StorageObjectsURL defines the URL of the Cloud Storage API listing objects
+// in a bucket.
+const StorageObjectsURL = "https://www.googleapis.com/storage/v1/b/%v/o"
+
+// CacheKey returns a content hash of the sections of a script which decide
+// how it runs and where its results are stored; i.e. all sections but its
+// name, queue, matrix, parent, scheduling sections, follow-up tasks, and
+// cache. Variables in them are hashed as written.
+func (s *Script) CacheKey() (string, error) {
+
+	// Sections added later are hashed unless they're cleared here.
+	hashed := *s
+	hashed.Name = ""
+	hashed.Queue = ""
+	hashed.Matrix = nil
+	hashed.Parent = nil
+	hashed.Priority = 0
+	hashed.NotBefore = nil
+	hashed.ExpiresAt = nil
+	hashed.Requires = nil
+	hashed.DependsOn = nil
+	hashed.Next = nil
+	hashed.Cache = false
+
+	data, err := json.Marshal(&hashed)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+
+}
+
+// cachedResult returns the result of a previous run of a script which can be
+// reused; the run must have succeeded and its results must still exist.
+// It returns nil if there are no such runs.
+func cachedResult(ctx context.Context, store ResultStore, key string) (res *TaskResult, err error) {
+
+	if store == nil {
+		return
+	}
+	res, err = store.Cached(ctx, key)
+	if err != nil || res == nil {
+		return
+	}
+	if res.Result == "" {
+		return nil, nil
+	}
+	exist, err := ResultExists(ctx, res.Result)
+	if err != nil || !exist {
+		return nil, err
+	}
+	return
+
+}
+
+// ResultExists returns true if a given result location in Cloud Storage has
+// any objects.
+func ResultExists(ctx context.Context, location string) (exist bool, err error) {
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return
+	} else if u.Scheme != "gs" {
+		return false, fmt.Errorf("unsupported result location: %v", location)
+	}
+
+	token, err := AccessToken(ctx)
+	if err != nil {
+		return
+	}
+	query := url.Values{}
+	query.Set("prefix", strings.TrimPrefix(u.Path, "/"))
+	query.Set("maxResults", "1")
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(StorageObjectsURL, u.Host)+"?"+query.Encode(), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := ctxhttp.Do(ctx, nil, req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, nil
+	case res.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("cannot list objects in %v: %v", location, res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return
+	}
+	var objects struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err = json.Unmarshal(data, &objects); err != nil {
+		return
+	}
+	return len(objects.Items) != 0, nil
+
+}
@@ -0,0 +1,158 @@
+//
+// cache_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+
+	notBefore := time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := time.Date(2017, 7, 2, 0, 0, 0, 0, time.UTC)
+	s := &Script{
+		Name:            "train",
+		Queue:           "default",
+		Image:           "python:3",
+		APT:             []string{"git"},
+		Source:          "https://github.com/jkawamoto/roadie-queue-manager.git",
+		Data:            []string{"gs://somebucket/data.csv"},
+		Run:             []Step{Step{Command: "python train.py"}},
+		Result:          "gs://somebucket/{{task}}",
+		Upload:          []string{"*.h5"},
+		OnFailure:       []Step{Step{Command: "tar czf dump.tar.gz checkpoints"}},
+		Finally:         []Step{Step{Command: "rm -rf /tmp/cache"}},
+		StopOnFailure:   true,
+		UploadOnFailure: true,
+		Matrix:          map[string][]string{"lr": []string{"0.1", "0.01"}},
+		Params:          map[string]string{"model": "cnn"},
+		Parent:          &Parent{Name: "search"},
+		Env:             map[string]string{"EPOCHS": "10"},
+		Timeout:         time.Hour,
+		Logs:            LogNames{Stdout: "{{step}}.out"},
+		Priority:        3,
+		NotBefore:       &notBefore,
+		ExpiresAt:       &expiresAt,
+		Requires:        []string{"gpu"},
+		DependsOn:       []string{"preprocess"},
+		Next:            &Next{OnSuccess: []FollowUp{FollowUp{Name: "evaluate"}}},
+		Secrets:         []SecretOpt{SecretOpt{Name: "api-key", Env: "TOKEN"}},
+		Cache:           true,
+	}
+	key, err := s.CacheKey()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Sections which don't change how a script runs.
+	ignored := map[string]bool{
+		"Name":      true,
+		"Queue":     true,
+		"Matrix":    true,
+		"Parent":    true,
+		"Priority":  true,
+		"NotBefore": true,
+		"ExpiresAt": true,
+		"Requires":  true,
+		"DependsOn": true,
+		"Next":      true,
+		"Cache":     true,
+	}
+	// Every section must be set so that the test covers sections added later.
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		zero := reflect.Zero(v.Field(i).Type())
+		if reflect.DeepEqual(v.Field(i).Interface(), zero.Interface()) {
+			t.Fatalf("Section %v isn't set in the test script", name)
+		}
+
+		modified := *s
+		reflect.ValueOf(&modified).Elem().Field(i).Set(zero)
+		res, err := modified.CacheKey()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if ignored[name] && res != key {
+			t.Errorf("Cache key changes by section %v", name)
+		} else if !ignored[name] && res == key {
+			t.Errorf("Cache key doesn't change by section %v", name)
+		}
+	}
+
+	// Options of steps are also hashed.
+	modified := *s
+	modified.Run = []Step{Step{Command: "python train.py", Workdir: "src"}}
+	if res, err := modified.CacheKey(); err != nil {
+		t.Fatal(err.Error())
+	} else if res == key {
+		t.Error("Cache key doesn't change by options of steps")
+	}
+
+}
+
+func TestCachedResult(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	store := &FileResultStore{Dir: dir}
+	if err = store.Put(ctx, &TaskResult{Name: "train", Status: TaskFailed, CacheKey: "key1"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if res, err := store.Cached(ctx, "key1"); err != nil || res != nil {
+		t.Errorf("Failed result is cached: %+v, %v", res, err)
+	}
+
+	if err = store.Put(ctx, &TaskResult{Name: "train2", Status: TaskSucceeded, CacheKey: "key1"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if res, err := store.Cached(ctx, "key1"); err != nil {
+		t.Fatal(err.Error())
+	} else if res == nil || res.Name != "train2" {
+		t.Errorf("Cached result is %+v, want train2", res)
+	}
+	if res, err := store.Get(ctx, "train"); err != nil || res == nil || res.Status != TaskFailed {
+		t.Errorf("Result of train is %+v, %v", res, err)
+	}
+
+	// Results without result locations cannot be reused.
+	if res, err := cachedResult(ctx, store, "key1"); err != nil || res != nil {
+		t.Errorf("Result without a result location is reused: %+v, %v", res, err)
+	}
+	if res, err := cachedResult(ctx, nil, "key1"); err != nil || res != nil {
+		t.Errorf("Result is reused without any result stores: %+v, %v", res, err)
+	}
+	if _, err = ResultExists(ctx, "s3://somebucket/result"); err == nil {
+		t.Error("Result location in an unsupported scheme is checked")
+	}
+
+}
@@ -0,0 +1,196 @@
+//
+// cleanup.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// LabelTask defines the label of sandbox containers which has the name of
+	// the task.
+	LabelTask = "roadie-queue-manager.task"
+	// DefaultKeepImages defines the default number of images kept.
+	DefaultKeepImages = 3
+)
+
+// CleanupPolicy defines which containers and images are kept after tasks.
+type CleanupPolicy struct {
+	// Images is the number of images kept, which are the most recently used
+	// ones; a negative number keeps all images.
+	Images int
+	// FailedContainers is how long containers of failed tasks are kept for
+	// inspection after they exit; 0 removes them immediately.
+	FailedContainers time.Duration
+}
+
+// Cleaner is implemented by executors which can remove containers and images
+// they created.
+type Cleaner interface {
+	// Cleanup removes exited containers and images according to a policy.
+	Cleanup(ctx context.Context, policy *CleanupPolicy) error
+}
+
+// cleanup removes containers and images left by tasks if the executor
+// supports it; it is called at startup and after each task.
+func cleanup(ctx context.Context, cfg *Config, logger *log.Logger) {
+
+	c, ok := cfg.Executor.(Cleaner)
+	if !ok || cfg.Cleanup == nil {
+		// Configs created without command line options keep everything.
+		return
+	}
+	if err := c.Cleanup(ctx, cfg.Cleanup); err != nil {
+		logger.Println("Cannot clean up containers and images:", err.Error())
+	}
+
+}
+
+// Cleanup removes exited containers created for tasks except failed ones
+// kept by the policy, and images except the most recently used ones and ones
+// used by remaining containers. Containers and images which cannot be removed
+// are skipped, and the first error is returned.
+func (e *DockerExecutor) Cleanup(ctx context.Context, policy *CleanupPolicy) (err error) {
+
+	docker, err := client.NewEnvClient()
+	if err != nil {
+		return
+	}
+	defer docker.Close()
+
+	containers, err := docker.ContainerList(ctx, types.ContainerListOptions{
+		All: true,
+	})
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	inUse := make(map[string]bool)
+	for _, c := range containers {
+		if _, ok := c.Labels[LabelTask]; !ok {
+			continue
+		}
+		info, inspectErr := docker.ContainerInspect(ctx, c.ID)
+		if inspectErr != nil {
+			// The image is kept since the container may still use it.
+			inUse[c.Image] = true
+			if err == nil {
+				err = inspectErr
+			}
+			continue
+		}
+		if !containerExpired(info.State, policy, now) {
+			inUse[c.Image] = true
+			continue
+		}
+		removeErr := docker.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{
+			Force: true,
+		})
+		if removeErr != nil {
+			inUse[c.Image] = true
+			if err == nil {
+				err = removeErr
+			}
+		}
+	}
+
+	if policy.Images < 0 {
+		return
+	}
+	images, listErr := docker.ImageList(ctx, types.ImageListOptions{})
+	if listErr != nil {
+		if err == nil {
+			err = listErr
+		}
+		return
+	}
+	used := make(map[string]time.Time)
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			if strings.HasPrefix(tag, ImageRepository+":") {
+				used[tag] = e.lastUsed(tag, time.Unix(image.Created, 0))
+			}
+		}
+	}
+	for _, image := range imagesToRemove(used, policy.Images, inUse) {
+		_, removeErr := docker.ImageRemove(ctx, image, types.ImageRemoveOptions{
+			PruneChildren: true,
+		})
+		if removeErr != nil && err == nil {
+			err = removeErr
+		}
+	}
+	return
+
+}
+
+// containerExpired returns true if a container in a given state can be
+// removed at a given time.
+func containerExpired(state *types.ContainerState, policy *CleanupPolicy, now time.Time) bool {
+
+	if state == nil {
+		return true
+	} else if state.Running {
+		return false
+	} else if state.ExitCode == 0 {
+		return true
+	}
+	finished, err := time.Parse(time.RFC3339Nano, state.FinishedAt)
+	if err != nil {
+		return true
+	}
+	return !now.Before(finished.Add(policy.FailedContainers))
+
+}
+
+// imagesToRemove returns images which aren't in use nor in the given number
+// of the most recently used ones.
+func imagesToRemove(used map[string]time.Time, keep int, inUse map[string]bool) (images []string) {
+
+	names := make([]string, 0, len(used))
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if !used[names[i]].Equal(used[names[j]]) {
+			return used[names[i]].After(used[names[j]])
+		}
+		return names[i] < names[j]
+	})
+	if keep > len(names) {
+		keep = len(names)
+	}
+	for _, name := range names[keep:] {
+		if !inUse[name] {
+			images = append(images, name)
+		}
+	}
+	return
+
+}
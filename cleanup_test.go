@@ -0,0 +1,109 @@
+//
+// cleanup_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestContainerExpired(t *testing.T) {
+
+	now := time.Date(2017, 7, 5, 10, 30, 0, 0, time.UTC)
+	policy := &CleanupPolicy{FailedContainers: 30 * time.Minute}
+	cases := []struct {
+		State  *types.ContainerState
+		Expect bool
+	}{
+		{&types.ContainerState{Running: true}, false},
+		{&types.ContainerState{ExitCode: 0, FinishedAt: "2017-07-05T10:29:00Z"}, true},
+		{&types.ContainerState{ExitCode: 1, FinishedAt: "2017-07-05T10:10:00.123456789Z"}, false},
+		{&types.ContainerState{ExitCode: 1, FinishedAt: "2017-07-05T10:00:00Z"}, true},
+		{&types.ContainerState{ExitCode: 137, FinishedAt: "2017-07-05T09:00:00Z"}, true},
+	}
+	for _, c := range cases {
+		if res := containerExpired(c.State, policy, now); res != c.Expect {
+			t.Errorf("Container in %+v is expired: %v, want %v", c.State, res, c.Expect)
+		}
+	}
+
+}
+
+func TestImagesToRemove(t *testing.T) {
+
+	now := time.Now()
+	used := map[string]time.Time{
+		"roadie-env:a": now.Add(-4 * time.Hour),
+		"roadie-env:b": now.Add(-time.Hour),
+		"roadie-env:c": now.Add(-3 * time.Hour),
+		"roadie-env:d": now.Add(-2 * time.Hour),
+		"roadie-env:e": now,
+	}
+	res := imagesToRemove(used, 2, map[string]bool{"roadie-env:c": true})
+	if expect := []string{"roadie-env:d", "roadie-env:a"}; !reflect.DeepEqual(res, expect) {
+		t.Errorf("Removed images are %v, want %v", res, expect)
+	}
+	if res = imagesToRemove(used, 10, nil); len(res) != 0 {
+		t.Errorf("Removed images are %v, want none", res)
+	}
+	if res = imagesToRemove(used, 0, nil); len(res) != 5 {
+		t.Errorf("Removed images are %v, want all", res)
+	}
+
+}
+
+// testCleaner is an executor recording cleanup policies.
+type testCleaner struct {
+	fakeExecutor
+	policies []*CleanupPolicy
+}
+
+func (c *testCleaner) Cleanup(ctx context.Context, policy *CleanupPolicy) error {
+	c.policies = append(c.policies, policy)
+	return nil
+}
+
+func TestCleanup(t *testing.T) {
+
+	logger := log.New(ioutil.Discard, "", 0)
+	policy := &CleanupPolicy{Images: 3}
+	executor := new(testCleaner)
+	cleanup(context.Background(), &Config{Executor: executor, Cleanup: policy}, logger)
+	if len(executor.policies) != 1 || executor.policies[0] != policy {
+		t.Errorf("Cleanup is called with %v", executor.policies)
+	}
+
+	// Cleanup is disabled without a policy.
+	cleanup(context.Background(), &Config{Executor: executor}, logger)
+	if len(executor.policies) != 1 {
+		t.Errorf("Cleanup is called without a policy")
+	}
+	// Executors not supporting cleanup are ignored.
+	cleanup(context.Background(), &Config{Executor: new(fakeExecutor), Cleanup: policy}, logger)
+
+}
@@ -26,16 +26,13 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/jkawamoto/roadie/cloud/gcp"
-	"github.com/jkawamoto/roadie/script"
-
-	yaml "gopkg.in/yaml.v2"
 )
 
 // Exit codes are int values that represent an exit code for a particular error.
@@ -52,6 +49,8 @@ const (
 
 // CLI is the command line object
 type CLI struct {
+	// inStream is the stdin to read inputs of helper commands.
+	inStream io.Reader
 	// outStream and errStream are the stdout and stderr
 	// to write message from the CLI.
 	outStream, errStream io.Writer
@@ -60,14 +59,37 @@ type CLI struct {
 // Run invokes the CLI with the given arguments.
 func (cli *CLI) Run(args []string) int {
 	var (
-		version bool
+		version  bool
+		secrets  string
+		logSink  string
+		results  string
+		schedule string
+		executor string
+		cfg      Config
 	)
+	cfg.Labels = make(Labels)
+	cfg.Cleanup = new(CleanupPolicy)
 
 	// Define option flag parse
 	flags := flag.NewFlagSet(Name, flag.ContinueOnError)
 	flags.SetOutput(cli.errStream)
 
 	flags.BoolVar(&version, "version", false, "Print version information and quit.")
+	flags.StringVar(&cfg.DeployKey, "deploy-key", "", "SSH private key file used to clone git repositories.")
+	flags.StringVar(&cfg.KnownHosts, "known-hosts", "", "known_hosts file which has host keys of git servers; required with -deploy-key.")
+	flags.StringVar(&cfg.CredentialFile, "credentials", "", "netrc file which has credentials to download files and clone git repositories.")
+	flags.StringVar(&secrets, "secrets", "", "Secret provider given as file:<dir>, env:<prefix>, or local:<file>.")
+	flags.StringVar(&results, "results", "file:"+ResultDir, "Result store results of tasks are stored given as file:<dir> or datastore:[<project>].")
+	flags.StringVar(&executor, "executor", ExecutorDocker, "Container runtime running scripts: docker, podman, or process.")
+	flags.IntVar(&cfg.Cleanup.Images, "keep-images", DefaultKeepImages, "Number of the most recently used images kept; negative numbers keep all images.")
+	flags.DurationVar(&cfg.Cleanup.FailedContainers, "keep-failed", 0, "How long containers of failed tasks are kept for inspection.")
+	flags.BoolVar(&cfg.Force, "force", false, "Rerun scripts enabling the cache even if results of the same scripts exist.")
+	flags.StringVar(&cfg.Matrix, "matrix", MatrixLocal, "How to run scripts expanded from a matrix: local runs them in this instance, and enqueue adds them to the queue.")
+	flags.StringVar(&cfg.QueuePolicy, "queue-policy", QueuePolicyStrict, "How to choose a queue to fetch a task from: strict fetches from the first queue having tasks, and weighted fetches in proportion to weights.")
+	flags.Var(cfg.Labels, "labels", "Capability labels of this instance given as <key>[=<value>],...")
+	flags.StringVar(&schedule, "schedule", "", "YAML file which has recurring tasks to be enqueued in the cron format.")
+	flags.BoolVar(&cfg.Daemon, "daemon", false, "Keep waiting for tasks when the queues are empty instead of stopping.")
+	flags.StringVar(&logSink, "log-sink", "", "Log sink outputs of tasks are sent to given as file:<path>, an HTTP(S) URL, or syslog:[<network>://<address>].")
 
 	// Parse commandline flag
 	if err := flags.Parse(args[1:]); err != nil {
@@ -80,19 +102,93 @@ func (cli *CLI) Run(args []string) int {
 		return ExitCodeOK
 	}
 
+	// Run a helper command used in sandbox containers.
+	if helper, ok := helpers[flags.Arg(0)]; ok {
+		return helper(cli, flags.Args()[1:])
+	}
+
 	if flags.NArg() != 2 {
-		fmt.Println("Usage: roadie-queue-manager <project id> <queue name>")
+		fmt.Println("Usage: roadie-queue-manager [-deploy-key <file> -known-hosts <file>] [-credentials <file>] [-secrets <provider>] [-log-sink <sink>] [-results <store>] [-matrix <local|enqueue>] [-queue-policy <strict|weighted>] [-labels <labels>] [-schedule <file>] [-daemon] [-force] [-executor <docker|podman|process>] [-keep-images <n>] [-keep-failed <duration>] <project id> <queue name>[:<weight>][,...]")
+		return ExitCodeError
+	}
+
+	if cfg.DeployKey != "" && cfg.KnownHosts == "" {
+		fmt.Fprintln(cli.errStream, "-deploy-key requires -known-hosts to verify git servers")
+		return ExitCodeError
+	}
+
+	var err error
+	if secrets != "" {
+		if cfg.Secrets, err = NewSecretProvider(secrets); err != nil {
+			fmt.Fprintln(cli.errStream, err.Error())
+			return ExitCodeError
+		}
+	}
+
+	if cfg.Matrix != MatrixLocal && cfg.Matrix != MatrixEnqueue {
+		fmt.Fprintln(cli.errStream, "Unknown matrix mode:", cfg.Matrix)
 		return ExitCodeError
 	}
 
-	if err := run(flags.Arg(0), flags.Arg(1)); err != nil {
+	if cfg.QueuePolicy != QueuePolicyStrict && cfg.QueuePolicy != QueuePolicyWeighted {
+		fmt.Fprintln(cli.errStream, "Unknown queue policy:", cfg.QueuePolicy)
+		return ExitCodeError
+	}
+
+	if cfg.Queues, err = ParseQueues(flags.Arg(1)); err != nil {
+		fmt.Fprintln(cli.errStream, err.Error())
+		return ExitCodeError
+	}
+
+	if cfg.Executor, err = NewExecutor(executor); err != nil {
+		fmt.Fprintln(cli.errStream, err.Error())
+		return ExitCodeError
+	}
+	// Cleanup options are supported only by executors which can remove
+	// containers and images.
+	if _, ok := cfg.Executor.(Cleaner); !ok {
+		var unsupported []string
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "keep-images" || f.Name == "keep-failed" {
+				unsupported = append(unsupported, "-"+f.Name)
+			}
+		})
+		if len(unsupported) != 0 {
+			fmt.Fprintln(cli.errStream, strings.Join(unsupported, " and "), "cannot be used with executor", executor)
+			return ExitCodeError
+		}
+	}
+
+	if schedule != "" {
+		if cfg.Schedule, err = ReadSchedule(schedule); err != nil {
+			fmt.Fprintln(cli.errStream, err.Error())
+			return ExitCodeError
+		}
+	}
+
+	if results != "" {
+		if cfg.Results, err = NewResultStore(results, flags.Arg(0)); err != nil {
+			fmt.Fprintln(cli.errStream, err.Error())
+			return ExitCodeError
+		}
+	}
+
+	if logSink != "" {
+		if cfg.LogSink, err = NewLogSink(logSink); err != nil {
+			fmt.Fprintln(cli.errStream, err.Error())
+			return ExitCodeError
+		}
+		defer cfg.LogSink.Close()
+	}
+
+	if err := run(flags.Arg(0), &cfg); err != nil {
 		fmt.Println(err.Error())
 		return ExitCodeError
 	}
 	return ExitCodeOK
 }
 
-func run(project, queue string) (err error) {
+func run(project string, cfg *Config) (err error) {
 	logger := log.New(os.Stdout, "", 0)
 
 	defer func() (err error) {
@@ -128,6 +224,70 @@ func run(project, queue string) (err error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Load credentials; scripts can still be run without them.
+	if cfg.CredentialFile != "" {
+		if cfg.Credentials, err = ReadNetrc(cfg.CredentialFile); err != nil {
+			logger.Println("Cannot load credentials:", err.Error())
+		}
+	}
+
+	// Names of this instance and its zone are given to scripts as built-in
+	// variables.
+	if hostname, e := Hostname(ctx); e != nil {
+		logger.Println("Cannot retrieve the hostname:", e.Error())
+	} else {
+		cfg.Instance = strings.Split(hostname, ".")[0]
+	}
+	if zone, e := Zone(ctx); e != nil {
+		logger.Println("Cannot retrieve the zone name:", e.Error())
+	} else {
+		cfg.Zone = zone
+	}
+
+	// Labels given in the metadata are added to ones given by the flag, and
+	// the latter have priority.
+	if attr, e := Attribute(ctx, LabelsAttribute); e == nil {
+		labels := make(Labels)
+		if e = labels.Set(attr); e != nil {
+			logger.Println("Cannot parse labels in the metadata:", e.Error())
+		}
+		for k, v := range cfg.Labels {
+			labels[k] = v
+		}
+		cfg.Labels = labels
+	} else if e != ErrMetadataNotFound {
+		logger.Println("Cannot retrieve labels:", e.Error())
+	}
+	logger.Println("Labels of this instance:", cfg.Labels)
+
+	queues := strings.Join(QueueNames(cfg.Queues), ", ")
+	logger.Println("Connecting to queues", queues)
+	// Fetched tasks record this instance so that other instances skip them.
+	worker := cfg.Instance
+	if worker == "" {
+		worker, _ = os.Hostname()
+	}
+	backend, err := NewGCPQueue(ctx, project, worker, logger)
+	if err != nil {
+		logger.Println("Cannot create a queue service:", err.Error())
+		return
+	}
+	scheduler := &Scheduler{
+		Backend: backend,
+		Queues:  cfg.Queues,
+		Policy:  cfg.QueuePolicy,
+	}
+	materializer := &Materializer{
+		Backend:     backend,
+		Occurrences: backend,
+		Results:     cfg.Results,
+		Tasks:       cfg.Schedule,
+		Queue:       cfg.Queues[0].Name,
+	}
+
+	// Containers and images left by earlier runs are removed.
+	cleanup(ctx, cfg, logger)
+
 	// Check a script file exists.
 	// If there are script files, it measn VM was restarted during the run.
 	// The script file must be restarted.
@@ -139,20 +299,30 @@ func run(project, queue string) (err error) {
 	} else {
 
 		for _, filename := range matches {
-			logger.Println("Find an unfinished task", filename, "and run it again")
+			logger.Println("Find an unfinished task", filename, "and resume it")
 
-			var s *script.Script
-			s, err = script.NewScript(filename)
+			var task *Task
+			task, err = ReadRecoveryFile(filename)
 			if err != nil {
 				logger.Println("Cannot read", filename, "and skip it:", err.Error())
 				continue
 			}
+			// Files written by older versions don't record the queue the task
+			// was fetched from; the first queue is assumed.
+			if task.Queue == "" {
+				task.Queue = cfg.Queues[0].Name
+				task.Script.Queue = task.Queue
+			}
 
-			err = ExecuteScript(ctx, s, logger)
+			stop := KeepClaim(ctx, backend, task, logger)
+			err = runTask(ctx, backend, task, cfg, logger)
+			stop()
 			if err != nil {
 				logger.Println("Cannot finish task", filename, ":", err.Error())
 				continue
 			}
+			// The task fetched by this instance is still in its queue.
+			backend.Delete(ctx, task.Queue, task.Name)
 			os.Remove(filename)
 
 		}
@@ -160,48 +330,208 @@ func run(project, queue string) (err error) {
 	}
 
 	// Start checking queue and executing each script.
-	logger.Println("Requesting a task from queue", queue)
-	qService, err := gcp.NewQueueService(ctx, &gcp.Config{
-		Project: project,
-	}, logger)
-	if err != nil {
-		logger.Println("Cannot create a queue service:", err.Error())
-		return
-	}
-
-	var task *gcp.Task
+	logger.Println("Requesting a task from queues", queues)
+	var task *Task
+	// released has names of tasks put back to the queue since a task ran
+	// last, dependent is true if some of them are waiting for dependencies or
+	// their scheduled times, and
+	// waitingSince is when this instance started waiting for them.
+	released := make(map[string]bool)
+	dependent := false
+	var waitingSince time.Time
 	for {
-		task, err = qService.Fetch(ctx, queue)
+		if e := materializer.Materialize(ctx, time.Now(), logger); e != nil {
+			logger.Println("Cannot enqueue scheduled tasks:", e.Error())
+		}
+
+		task, err = scheduler.Fetch(ctx)
 		if err != nil {
 			logger.Println("Cannot fetch any tasks:", err.Error())
 			return
 		} else if task == nil {
-			return
+			if !cfg.Daemon {
+				return
+			}
+			// Scheduled tasks are enqueued only while this instance runs, and
+			// other instances may enqueue tasks later.
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(ScheduleWaitInterval):
+			}
+			continue
 		}
 
-		logger.Println("Recieved a task", task.Name, "from queue", queue)
+		logger.Println("Recieved a task", task.Name, "from queue", task.Queue)
 
-		// Store a given script into a file so that if this program will be stopped accidentaly,
-		// the given script won't be lost.
-		var raw []byte
-		raw, err = yaml.Marshal(task.Script)
-		if err != nil {
-			logger.Println("Cannot marshal the task", task.Name, "but can continue processing:", err.Error())
-		} else {
-			path := filepath.Join(ScriptDir, fmt.Sprintf("%s.yml", task.Name))
-			err = ioutil.WriteFile(path, raw, 0644)
-			if err != nil {
-				logger.Println("Cannot store the task", task.Name, "but can continue processing:", err.Error())
+		// Expired tasks are dropped, and tasks this instance cannot run now
+		// are released to the queue.
+		if s := task.Script; s.ExpiresAt != nil && !time.Now().Before(*s.ExpiresAt) {
+			logger.Println("Task", task.Name, "expired at", s.ExpiresAt.Format(time.RFC3339))
+			if err = expireTask(ctx, cfg, s); err != nil {
+				logger.Println("Cannot store the result of task", task.Name, ":", err.Error())
+			} else if err = finishParent(ctx, backend, cfg, s, logger); err != nil {
+				logger.Println("Cannot finish the parent task of", task.Name, ":", err.Error())
+			}
+			backend.Delete(ctx, task.Queue, task.Name)
+			continue
+		}
+		var (
+			reason string
+			wait   bool
+		)
+		reason, wait, err = holdReason(ctx, cfg, task.Script, time.Now())
+		if depErr, ok := err.(*DependencyError); ok {
+			// The task will never run since a dependency didn't succeed.
+			logger.Println("Task", task.Name, "cannot run:", depErr.Error())
+			if err = failTask(ctx, cfg, task.Script, depErr); err != nil {
+				logger.Println("Cannot store the result of task", task.Name, ":", err.Error())
+			} else if err = finishParent(ctx, backend, cfg, task.Script, logger); err != nil {
+				logger.Println("Cannot finish the parent task of", task.Name, ":", err.Error())
+			}
+			backend.Delete(ctx, task.Queue, task.Name)
+			continue
+		} else if err != nil {
+			// The task is released so that it can be checked again later.
+			reason = fmt.Sprintf("has dependencies which cannot be checked: %v", err.Error())
+			wait = true
+		}
+		if reason != "" {
+			logger.Println("Task", task.Name, reason)
+			if released[task.Name] {
+				// Every fetched task has been released; if none of them will
+				// be able to run, no tasks can run in this instance.
+				if !dependent {
+					logger.Println("No tasks in the queues can run in this instance")
+					return
+				}
+				// Otherwise, wait for a while so that dependencies running in
+				// other instances can finish, but not forever.
+				if waitingSince.IsZero() {
+					waitingSince = time.Now()
+				} else if time.Since(waitingSince) >= DependencyWaitTimeout {
+					logger.Println("No tasks in the queues have been able to run for", DependencyWaitTimeout)
+					return
+				}
+				released = make(map[string]bool)
+				dependent = false
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(DependencyWaitInterval):
+				}
+			}
+			released[task.Name] = true
+			dependent = dependent || wait
+			if err = releaseTask(ctx, backend, task); err != nil {
+				logger.Println("Cannot release task", task.Name, ":", err.Error())
+				return
 			}
+			continue
+		}
+		released = make(map[string]bool)
+		dependent = false
+		waitingSince = time.Time{}
+
+		// Store a given task into a file so that if this program will be stopped accidentaly,
+		// the given task won't be lost.
+		path := filepath.Join(ScriptDir, fmt.Sprintf("%s.yml", task.Name))
+		if err = WriteRecoveryFile(path, task); err != nil {
+			logger.Println("Cannot store the task", task.Name, "but can continue processing:", err.Error())
 		}
 
-		// Execute a script.
-		err = ExecuteScript(ctx, task.Script, log.New(os.Stdout, fmt.Sprintf("task-%v:", task.Name), 0))
+		// Execute a script; the claim of the task is renewed while it runs so
+		// that other instances don't fetch it.
+		stop := KeepClaim(ctx, backend, task, logger)
+		err = runTask(ctx, backend, task, cfg, logger)
+		stop()
 		if err != nil {
 			logger.Println("Failed to execute task", task.Name, ":", err.Error())
 		}
-		qService.DeleteTask(ctx, queue, task.Name)
+		backend.Delete(ctx, task.Queue, task.Name)
+		os.Remove(path)
+
+	}
+
+}
+
+// runTask executes the script of a task. A script having a matrix section is
+// expanded, and the expanded scripts are executed one by one or enqueued as
+// child tasks according to the matrix mode.
+func runTask(ctx context.Context, backend QueueBackend, task *Task, cfg *Config, logger *log.Logger) (err error) {
 
+	scripts := []*Script{task.Script}
+	if len(task.Script.Matrix) != 0 {
+		scripts, err = ExpandMatrix(task.Script)
+		if err != nil {
+			return
+		}
+		if cfg.Matrix == MatrixEnqueue {
+			// The result of this task refers the children so that tasks
+			// depending on it wait for them.
+			res := &TaskResult{
+				Name:      task.Name,
+				Status:    TaskEnqueued,
+				StartedAt: time.Now(),
+			}
+			for _, s := range scripts {
+				s.Parent = &Parent{
+					Name: task.Name,
+					Next: task.Script.Next,
+				}
+				err = backend.Enqueue(ctx, &Task{
+					Name:   s.Name,
+					Queue:  task.Queue,
+					Script: s,
+				})
+				if err == ErrTaskExists {
+					logger.Println("Task", s.Name, "is already in queue", task.Queue)
+					continue
+				} else if err != nil {
+					return
+				}
+				logger.Println("Enqueued task", s.Name, "with parameters", s.Params)
+			}
+			for _, s := range scripts {
+				res.Children = append(res.Children, s.Name)
+			}
+			res.FinishedAt = time.Now()
+			if cfg.Results != nil {
+				if e := cfg.Results.Put(ctx, res); e != nil {
+					logger.Println("Cannot store the result of task", task.Name, ":", e.Error())
+				}
+			}
+			return nil
+		}
+	}
+
+	results := make([]*TaskResult, len(scripts))
+	for i, s := range scripts {
+		var e error
+		results[i], e = ExecuteScript(ctx, s, cfg, log.New(os.Stdout, fmt.Sprintf("task-%v:", s.Name), 0))
+		if e != nil {
+			err = e
+		}
+		cleanup(ctx, cfg, logger)
+	}
+
+	// Follow-up tasks of a matrix script are enqueued once according to the
+	// aggregated result of the expanded scripts.
+	res := results[0]
+	if len(task.Script.Matrix) != 0 {
+		res = MatrixResult(task.Script, results)
+		if cfg.Results != nil {
+			if e := cfg.Results.Put(ctx, res); e != nil {
+				logger.Println("Cannot store the result of task", task.Name, ":", e.Error())
+			}
+		}
+	}
+	if e := enqueueFollowUps(ctx, backend, task.Script, res, logger); e != nil {
+		logger.Println("Cannot enqueue follow-up tasks of", task.Name, ":", e.Error())
+	}
+	if e := finishParent(ctx, backend, cfg, task.Script, logger); e != nil {
+		logger.Println("Cannot finish the parent task of", task.Name, ":", e.Error())
 	}
+	return
 
 }
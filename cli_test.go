@@ -23,7 +23,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -43,3 +50,247 @@ func TestRun_versionFlag(t *testing.T) {
 		t.Errorf("expected %q to eq %q", errStream.String(), expected)
 	}
 }
+
+func TestRun_cleanupFlagsWithPodman(t *testing.T) {
+	outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+	cli := &CLI{outStream: outStream, errStream: errStream}
+	args := strings.Split("./roadie-queue-manager -executor podman -keep-failed 1h project queue", " ")
+
+	status := cli.Run(args)
+	if status != ExitCodeError {
+		t.Errorf("expected %d to eq %d", status, ExitCodeError)
+	}
+	if !strings.Contains(errStream.String(), "-keep-failed") {
+		t.Errorf("expected %q to contain -keep-failed", errStream.String())
+	}
+}
+
+func TestRun_runHelper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	outStream, errStream := new(bytes.Buffer), new(bytes.Buffer)
+	cli := &CLI{inStream: strings.NewReader(""), outStream: outStream, errStream: errStream}
+	status := cli.Run([]string{
+		"./roadie-queue-manager", "run", "-name", "step0", "-env", "GREETING=hello world",
+		"-workdir", dir, "-status", filepath.Join(dir, "status.json"),
+		"--", "sh", "-c", `echo "$GREETING in $(pwd)"; exit 2`,
+	})
+	if status != 2 {
+		t.Errorf("expected %d to eq %d: %v", status, 2, errStream.String())
+	}
+
+	expected := fmt.Sprintf("[step0] hello world in %s\n", dir)
+	if outStream.String() != expected {
+		t.Errorf("expected %q to eq %q", outStream.String(), expected)
+	}
+	res, err := ReadStepResult(filepath.Join(dir, "status.json"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.Name != "step0" || res.ExitStatus != 2 {
+		t.Errorf("expected result of step0 with exit status 2 but got %+v", res)
+	}
+}
+
+// testQueue is a queue backend storing tasks in memory.
+type testQueue struct {
+	tasks []*Task
+}
+
+func (q *testQueue) Fetch(ctx context.Context, queue string) (res *Task, err error) {
+	for _, task := range q.tasks {
+		if task.Queue != queue {
+			continue
+		}
+		if res == nil || taskPriority(task) > taskPriority(res) {
+			res = task
+		}
+	}
+	return
+}
+
+func taskPriority(task *Task) int {
+	if task.Script == nil {
+		return 0
+	}
+	return task.Script.Priority
+}
+
+func (q *testQueue) Enqueue(ctx context.Context, task *Task) error {
+	for _, t := range q.tasks {
+		if t.Queue == task.Queue && t.Name == task.Name {
+			return ErrTaskExists
+		}
+	}
+	q.tasks = append(q.tasks, task)
+	return nil
+}
+
+func (q *testQueue) Release(ctx context.Context, task *Task) error {
+	q.Delete(ctx, task.Queue, task.Name)
+	q.tasks = append(q.tasks, task)
+	return nil
+}
+
+func (q *testQueue) Renew(ctx context.Context, task *Task) error {
+	return nil
+}
+
+func (q *testQueue) Delete(ctx context.Context, queue, name string) error {
+	for i, task := range q.tasks {
+		if task.Queue == queue && task.Name == name {
+			q.tasks = append(q.tasks[:i], q.tasks[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func TestRunTask_enqueueMatrix(t *testing.T) {
+	queue := new(testQueue)
+	task := &Task{
+		Name:  "train",
+		Queue: "queue1",
+		Script: &Script{
+			Name: "train",
+			Matrix: map[string][]string{
+				"lr": {"0.1", "0.01"},
+			},
+			Run: []Step{
+				Step{Command: "python train.py --lr {{matrix.lr}}"},
+			},
+		},
+	}
+
+	err := runTask(context.Background(), queue, task, &Config{Matrix: MatrixEnqueue}, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(queue.tasks) != 2 {
+		t.Fatalf("expected 2 tasks to be enqueued but got %v", len(queue.tasks))
+	}
+	for i, lr := range []string{"0.1", "0.01"} {
+		child := queue.tasks[i]
+		if child.Queue != "queue1" || child.Name != fmt.Sprintf("train-%v", i) || child.Script.Params["lr"] != lr {
+			t.Errorf("expected a task with lr=%v but got %+v", lr, child)
+		}
+	}
+}
+
+func TestRunTask_enqueueMatrixFollowUps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	queue := new(testQueue)
+	cfg := &Config{Matrix: MatrixEnqueue, Results: &FileResultStore{Dir: dir}}
+	logger := log.New(ioutil.Discard, "", 0)
+	task := &Task{
+		Name:  "train",
+		Queue: "queue1",
+		Script: &Script{
+			Name: "train",
+			Matrix: map[string][]string{
+				"lr": {"0.1", "0.01"},
+			},
+			Run: []Step{
+				Step{Command: "python train.py --lr {{matrix.lr}}"},
+			},
+			Next: &Next{
+				OnSuccess: []FollowUp{
+					FollowUp{Name: "evaluate", Script: &Script{Data: []string{"{{input}}"}}},
+				},
+			},
+		},
+	}
+	if err = runTask(ctx, queue, task, cfg, logger); err != nil {
+		t.Fatal(err.Error())
+	}
+	children := append([]*Task{}, queue.tasks...)
+	for _, child := range children {
+		if child.Script.Next != nil || child.Script.Parent == nil || child.Script.Parent.Name != "train" {
+			t.Fatalf("expected child %v to refer its parent instead of having follow-ups but got %+v", child.Name, child.Script)
+		}
+		queue.Delete(ctx, child.Queue, child.Name)
+	}
+
+	// Follow-up tasks are enqueued once after all children end.
+	for i, child := range children {
+		err = cfg.Results.Put(ctx, &TaskResult{
+			Name:   child.Name,
+			Status: TaskSucceeded,
+			Result: fmt.Sprintf("gs://somebucket/train/%v/", i),
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if err = finishParent(ctx, queue, cfg, child.Script, logger); err != nil {
+			t.Fatal(err.Error())
+		}
+		if i == 0 && len(queue.tasks) != 0 {
+			t.Errorf("expected no follow-up tasks before all children end but got %v", len(queue.tasks))
+		}
+	}
+	// A child finishing again doesn't enqueue them twice.
+	if err = finishParent(ctx, queue, cfg, children[1].Script, logger); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(queue.tasks) != 1 || queue.tasks[0].Name != "evaluate" || queue.tasks[0].Script.Data[0] != "gs://somebucket/train/" {
+		t.Errorf("expected a follow-up task with the common result directory but got %+v", queue.tasks)
+	}
+	res, err := cfg.Results.Get(ctx, "train")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.Status != TaskSucceeded || len(res.Children) != 2 {
+		t.Errorf("expected the aggregated result of the parent but got %+v", res)
+	}
+}
+
+func TestRunTask_enqueueMatrixGCPQueue(t *testing.T) {
+	server := httptest.NewServer(new(fakeDatastore))
+	defer server.Close()
+	queue := newTestGCPQueue(server, "instance-1")
+
+	task := &Task{
+		Name:  "train",
+		Queue: "queue1",
+		Script: &Script{
+			Name: "train",
+			Matrix: map[string][]string{
+				"lr": {"0.1", "0.01"},
+			},
+			Run: []Step{
+				Step{Command: "python train.py --lr {{matrix.lr}}"},
+			},
+		},
+	}
+
+	ctx := context.Background()
+	err := runTask(ctx, queue, task, &Config{Matrix: MatrixEnqueue}, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	params := make(map[string]string)
+	for i := 0; i != 2; i++ {
+		child, err := queue.Fetch(ctx, "queue1")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if child == nil {
+			t.Fatalf("expected 2 tasks to be fetched but got %v", i)
+		}
+		params[child.Name] = child.Script.Params["lr"]
+	}
+	expect := map[string]string{"train-0": "0.1", "train-1": "0.01"}
+	if !reflect.DeepEqual(params, expect) {
+		t.Errorf("expected parameters %v but got %v", expect, params)
+	}
+}
@@ -0,0 +1,70 @@
+//
+// config.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+// Config defines options of this queue manager given from the command line.
+type Config struct {
+	// DeployKey is the path to a SSH private key used to clone git repositories.
+	DeployKey string
+	// KnownHosts is the path to a known_hosts file which has host keys of git
+	// servers accessed with the deploy key.
+	KnownHosts string
+	// CredentialFile is the path to a netrc file which has credentials.
+	CredentialFile string
+	// Credentials used to download files and clone git repositories.
+	Credentials CredentialStore
+	// Secrets resolves secrets requested by scripts.
+	Secrets SecretProvider
+	// LogSink receives outputs of sandbox containers; it can be nil.
+	LogSink LogSink
+	// Results stores results of tasks; it can be nil.
+	Results ResultStore
+	// Matrix is the mode of running scripts expanded from a matrix; either
+	// MatrixLocal or MatrixEnqueue.
+	Matrix string
+	// Queues are queues tasks are fetched from.
+	Queues []QueueSpec
+	// QueuePolicy is the policy to choose a queue to fetch a task from;
+	// either QueuePolicyStrict or QueuePolicyWeighted.
+	QueuePolicy string
+	// Schedule has recurring tasks enqueued by this queue manager.
+	Schedule []*ScheduledTask
+	// Daemon keeps this queue manager waiting for tasks when the queues are
+	// empty instead of stopping.
+	Daemon bool
+	// Labels are capability labels of this instance.
+	Labels Labels
+	// Executor builds images and runs sandbox containers; the Docker API is
+	// used if nil.
+	Executor Executor
+	// Cleanup is the policy to remove containers and images after tasks,
+	// which is given by command line options; executors which aren't Cleaners
+	// ignore it.
+	Cleanup *CleanupPolicy
+	// Force reruns scripts enabling the cache even if results of the same
+	// scripts exist.
+	Force bool
+	// Instance is the name of the instance this queue manager runs on.
+	Instance string
+	// Zone is the zone of the instance.
+	Zone string
+}
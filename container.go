@@ -0,0 +1,230 @@
+//
+// container.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ContainerOpt defines options to create a sandbox container.
+type ContainerOpt struct {
+	// Name of the container; a name is generated if empty.
+	Name  string
+	Image string
+	// Env is a list of environment variables given as KEY=VALUE.
+	Env    []string
+	Mounts []mount.Mount
+	Labels map[string]string
+	// KeepFailed is true if the container isn't removed when it fails.
+	KeepFailed bool
+}
+
+// RunContainer creates a container with given options, starts it, and writes
+// its stdout and stderr to given writers until it ends; it returns an error if
+// the container exits with a non-zero status. The container is killed if the
+// context is canceled, and removed after it ends unless it fails and is kept.
+func RunContainer(ctx context.Context, cli *client.Client, opt *ContainerOpt, stdout, stderr io.Writer) (err error) {
+
+	c, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:  opt.Image,
+		Env:    opt.Env,
+		Labels: opt.Labels,
+	}, &container.HostConfig{
+		Mounts: opt.Mounts,
+	}, nil, opt.Name)
+	if err != nil {
+		return
+	}
+	defer func() {
+		removeContainer(cli, c.ID, opt.KeepFailed && err != nil)
+	}()
+
+	// Waiting must start before the container starts so that its exit won't be missed.
+	statusCh, errCh := cli.ContainerWait(ctx, c.ID, container.WaitConditionNextExit)
+	if err = cli.ContainerStart(ctx, c.ID, types.ContainerStartOptions{}); err != nil {
+		return
+	}
+	return followContainer(ctx, cli, c.ID, statusCh, errCh, stdout, stderr)
+
+}
+
+// AttachContainer writes stdout and stderr of a running container since it
+// started to given writers until it ends; it returns an error if the container
+// exits with a non-zero status. The container is killed if the context is
+// canceled, and removed after it ends unless it fails and keepFailed is true.
+func AttachContainer(ctx context.Context, cli *client.Client, id string, keepFailed bool, stdout, stderr io.Writer) (err error) {
+
+	defer func() {
+		removeContainer(cli, id, keepFailed && err != nil)
+	}()
+
+	// All outputs are written so that ones produced while no queue managers
+	// were attached aren't lost.
+	statusCh, errCh := cli.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+	return followContainer(ctx, cli, id, statusCh, errCh, stdout, stderr)
+
+}
+
+// followContainer writes all outputs of a container to given writers until it
+// ends, and then checks its exit status; the container is killed if the
+// context is canceled.
+func followContainer(ctx context.Context, cli *client.Client, id string, statusCh <-chan container.ContainerWaitOKBody, errCh <-chan error, stdout, stderr io.Writer) (err error) {
+
+	// The container is killed when the context is canceled, e.g. by a timeout.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cli.ContainerKill(context.Background(), id, "KILL")
+		case <-done:
+		}
+	}()
+
+	reader, err := cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	if _, err = stdcopy.StdCopy(stdout, stderr, reader); err != nil {
+		return
+	}
+
+	select {
+	case status := <-statusCh:
+		if status.StatusCode != 0 {
+			err = fmt.Errorf("container exited with status %v", status.StatusCode)
+		}
+	case err = <-errCh:
+	}
+	return
+
+}
+
+// removeContainer removes a container unless it should be kept.
+func removeContainer(cli *client.Client, id string, keep bool) {
+	if keep {
+		return
+	}
+	cli.ContainerRemove(context.Background(), id, types.ContainerRemoveOptions{
+		Force: true,
+	})
+}
+
+// MaxLineLength defines the maximum length of a line of outputs of sandbox
+// containers; longer lines are split.
+const MaxLineLength = 64 * 1024
+
+// OutputStreamer forwards outputs of a sandbox container to a logger and a
+// log sink line by line.
+type OutputStreamer struct {
+	ctx    context.Context
+	task   string
+	logger *log.Logger
+	sink   LogSink
+	// secrets are masked in lines sent to the sink.
+	secrets [][]byte
+	// sinkFailed is true once the sink returns an error so that the error
+	// won't be logged for every line.
+	sinkFailed bool
+}
+
+// NewOutputStreamer creates an output streamer of a task; sink can be nil.
+func NewOutputStreamer(ctx context.Context, task string, logger *log.Logger, sink LogSink, secrets [][]byte) *OutputStreamer {
+	return &OutputStreamer{
+		ctx:     ctx,
+		task:    task,
+		logger:  logger,
+		sink:    sink,
+		secrets: secrets,
+	}
+}
+
+// Writer returns a writer which forwards lines written to it as a given
+// stream.
+func (s *OutputStreamer) Writer(stream string) *LineWriter {
+	return &LineWriter{
+		fn: func(line string) {
+			s.logger.Println(line)
+			if s.sink == nil {
+				return
+			}
+			err := s.sink.Write(s.ctx, &LogEntry{
+				Time:   time.Now(),
+				Task:   s.task,
+				Stream: stream,
+				Line:   MaskSecrets(line, s.secrets),
+			})
+			if err != nil && !s.sinkFailed {
+				s.sinkFailed = true
+				s.logger.Println("Cannot send outputs to the log sink:", err.Error())
+			}
+		},
+	}
+}
+
+// LineWriter calls a function for each line written to it.
+type LineWriter struct {
+	buf bytes.Buffer
+	fn  func(line string)
+}
+
+// Write buffers given bytes and calls the function for each completed line;
+// lines longer than MaxLineLength are split.
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		idx := bytes.IndexByte(w.buf.Bytes(), '\n')
+		switch {
+		case idx == -1 && w.buf.Len() < MaxLineLength:
+			return len(p), nil
+		case idx == -1 || idx >= MaxLineLength:
+			w.fn(string(w.buf.Next(MaxLineLength)))
+		default:
+			w.fn(strings.TrimRight(string(w.buf.Next(idx+1)), "\r\n"))
+		}
+	}
+}
+
+// Flush calls the function for the remaining incomplete line.
+func (w *LineWriter) Flush() {
+	if w.buf.Len() != 0 {
+		w.fn(w.buf.String())
+		w.buf.Reset()
+	}
+}
@@ -0,0 +1,107 @@
+//
+// container_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testLogSink stores written entries.
+type testLogSink struct {
+	entries []*LogEntry
+	err     error
+}
+
+func (s *testLogSink) Write(ctx context.Context, entry *LogEntry) error {
+	s.entries = append(s.entries, entry)
+	return s.err
+}
+
+func (s *testLogSink) Close() error {
+	return nil
+}
+
+func TestLineWriter(t *testing.T) {
+
+	var lines []string
+	w := &LineWriter{
+		fn: func(line string) {
+			lines = append(lines, line)
+		},
+	}
+	for _, str := range []string{"line1\r\nli", "ne2\n\n", "line4"} {
+		fmt.Fprint(w, str)
+	}
+	w.Flush()
+
+	expect := []string{"line1", "line2", "", "line4"}
+	if !reflect.DeepEqual(lines, expect) {
+		t.Errorf("Lines are %q, want %q", lines, expect)
+	}
+
+	lines = nil
+	fmt.Fprint(w, strings.Repeat("a", MaxLineLength+10)+"\nb")
+	w.Flush()
+	expect = []string{strings.Repeat("a", MaxLineLength), strings.Repeat("a", 10), "b"}
+	if !reflect.DeepEqual(lines, expect) {
+		t.Errorf("Long lines are split into %v lines, want %v", len(lines), len(expect))
+	}
+
+}
+
+func TestOutputStreamer(t *testing.T) {
+
+	buf := bytes.NewBuffer(nil)
+	sink := &testLogSink{
+		err: fmt.Errorf("sink error"),
+	}
+	secrets := [][]byte{[]byte("secret-token")}
+	logger := NewMaskedLogger(log.New(buf, "", 0), secrets)
+	s := NewOutputStreamer(context.Background(), "task1", logger, sink, secrets)
+
+	stdout := s.Writer(StreamStdout)
+	stderr := s.Writer(StreamStderr)
+	fmt.Fprintln(stdout, "[step0] token is secret-token")
+	fmt.Fprintln(stderr, "[step0] error")
+
+	if len(sink.entries) != 2 {
+		t.Fatalf("Sink received %v entries, want 2", len(sink.entries))
+	}
+	if e := sink.entries[0]; e.Task != "task1" || e.Stream != StreamStdout || e.Line != "[step0] token is "+SecretMask {
+		t.Errorf("First entry is %+v", e)
+	}
+	if e := sink.entries[1]; e.Stream != StreamStderr || e.Line != "[step0] error" {
+		t.Errorf("Second entry is %+v", e)
+	}
+
+	expect := "[step0] token is " + SecretMask + "\nCannot send outputs to the log sink: sink error\n[step0] error\n"
+	if buf.String() != expect {
+		t.Errorf("Logged messages are %q, want %q", buf.String(), expect)
+	}
+
+}
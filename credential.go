@@ -0,0 +1,284 @@
+//
+// credential.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultTokenLogin defines the user name sent with a bearer token when git
+// asks credentials.
+const DefaultTokenLogin = "oauth2"
+
+// Credential defines a credential to access a host.
+type Credential struct {
+	// Login and Password are used for the basic authentication.
+	Login    string
+	Password string
+	// Token is used as a bearer token; it has priority over Login and Password.
+	Token string
+}
+
+// CredentialStore maps host names to credentials. The empty host name
+// defines the default credential used for any hosts.
+type CredentialStore map[string]*Credential
+
+// ParseNetrc reads credentials written in the netrc format.
+//
+// In addition to machine, default, login, and password, token <value> sets
+// a bearer token. Lines starting with # are comments, and macdef is not
+// supported.
+func ParseNetrc(r io.Reader) (store CredentialStore, err error) {
+
+	var words []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if !strings.HasPrefix(line, "#") {
+			words = append(words, strings.Fields(line)...)
+		}
+	}
+	if err = s.Err(); err != nil {
+		return
+	}
+
+	store = make(CredentialStore)
+	var current *Credential
+	for i := 0; i < len(words); i++ {
+
+		key := words[i]
+		if key == "default" {
+			current = new(Credential)
+			store[""] = current
+			continue
+		}
+
+		switch key {
+		case "machine", "login", "password", "token", "account":
+		default:
+			return nil, fmt.Errorf("netrc: unknown token %v", key)
+		}
+		if i++; i == len(words) {
+			return nil, fmt.Errorf("netrc: missing value of %v", key)
+		}
+		value := words[i]
+
+		if key == "machine" {
+			current = new(Credential)
+			store[value] = current
+			continue
+		} else if current == nil {
+			return nil, fmt.Errorf("netrc: %v appears before machine", key)
+		}
+		switch key {
+		case "login":
+			current.Login = value
+		case "password":
+			current.Password = value
+		case "token":
+			current.Token = value
+		}
+
+	}
+	return
+
+}
+
+// ReadNetrc reads credentials from a netrc file.
+func ReadNetrc(filename string) (store CredentialStore, err error) {
+
+	fp, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	return ParseNetrc(fp)
+
+}
+
+// WriteNetrc writes credentials in the netrc format.
+func (store CredentialStore) WriteNetrc(w io.Writer) (err error) {
+
+	hosts := make([]string, 0, len(store))
+	for host := range store {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		c := store[host]
+		if host == "" {
+			_, err = fmt.Fprint(w, "default")
+		} else {
+			_, err = fmt.Fprintf(w, "machine %v", host)
+		}
+		if err != nil {
+			return
+		}
+		if c.Login != "" {
+			fmt.Fprintf(w, " login %v", c.Login)
+		}
+		if c.Password != "" {
+			fmt.Fprintf(w, " password %v", c.Password)
+		}
+		if c.Token != "" {
+			fmt.Fprintf(w, " token %v", c.Token)
+		}
+		if _, err = fmt.Fprintln(w); err != nil {
+			return
+		}
+	}
+	return
+
+}
+
+// Secrets returns passwords and tokens in this store so that they can be
+// masked in logs.
+func (store CredentialStore) Secrets() (secrets [][]byte) {
+
+	for _, c := range store {
+		for _, v := range []string{c.Password, c.Token} {
+			if v != "" {
+				secrets = append(secrets, []byte(v))
+			}
+		}
+	}
+	return
+
+}
+
+// Lookup returns the credential for a given host; the default one is
+// returned if there are no credentials for the host.
+func (store CredentialStore) Lookup(host string) *Credential {
+
+	if c, exist := store[host]; exist {
+		return c
+	}
+	return store[""]
+
+}
+
+// Filter returns a new store which has credentials only for given hosts.
+func (store CredentialStore) Filter(hosts []string) CredentialStore {
+
+	res := make(CredentialStore)
+	for _, host := range hosts {
+		if c, exist := store[host]; exist {
+			res[host] = c
+		} else if c, exist = store[""]; exist {
+			res[host] = c
+		}
+	}
+	return res
+
+}
+
+// Authorize sets an authorization header to a given request if this store
+// has a credential for the host of the request.
+func (store CredentialStore) Authorize(req *http.Request) {
+
+	c := store.Lookup(req.URL.Hostname())
+	switch {
+	case c == nil:
+	case c.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.Login != "" || c.Password != "":
+		req.SetBasicAuth(c.Login, c.Password)
+	}
+
+}
+
+// ServeGitCredential implements the git credential helper protocol; it reads
+// attributes of a credential request and writes the username and password.
+// Only get action is supported and the others are ignored.
+func (store CredentialStore) ServeGitCredential(action string, in io.Reader, out io.Writer) (err error) {
+
+	// Read the request even if it isn't used so that git won't get SIGPIPE.
+	attrs := make(map[string]string)
+	s := bufio.NewScanner(in)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			break
+		}
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+			attrs[kv[0]] = kv[1]
+		}
+	}
+	if err = s.Err(); err != nil || action != "get" {
+		return
+	}
+
+	host := attrs["host"]
+	if idx := strings.LastIndex(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+	c := store.Lookup(host)
+	if c == nil {
+		return
+	}
+
+	login, password := c.Login, c.Password
+	if c.Token != "" {
+		password = c.Token
+		if login == "" {
+			login = DefaultTokenLogin
+		}
+	}
+	_, err = fmt.Fprintf(out, "username=%v\npassword=%v\n", login, password)
+	return
+
+}
+
+// hostOf returns the host name of a URL; scp-like git URLs such as
+// git@github.com:user/repo.git are also supported.
+func hostOf(u string) string {
+
+	if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+		return parsed.Hostname()
+	}
+	if idx := strings.Index(u, ":"); idx != -1 {
+		host := u[:idx]
+		return host[strings.Index(host, "@")+1:]
+	}
+	return ""
+
+}
+
+// redactURL removes user information from a URL so that it can be logged.
+func redactURL(u string) string {
+
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.User == nil {
+		return u
+	}
+	parsed.User = nil
+	return parsed.String()
+
+}
@@ -0,0 +1,189 @@
+//
+// cron.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchLimit defines how far CronSchedule searches times matching it.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// CronSchedule is a schedule given in the cron format, which has minute,
+// hour, day of month, month, and day of week fields.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// If either day of month or day of week is restricted, a day matching
+	// either of them matches the schedule as cron does.
+	domStar, dowStar bool
+}
+
+// cronField defines the range of a field.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseCron parses a schedule in the cron format. Each field is *, a value,
+// a range a-b, or a list of them separated by commas; * and ranges can have
+// steps such as */15. 0 and 7 in the day of week field are Sunday.
+func ParseCron(spec string) (c *CronSchedule, err error) {
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron schedule must have %v fields: %v", len(cronFields), spec)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		if bits[i], err = parseCronField(field, cronFields[i]); err != nil {
+			return nil, err
+		}
+	}
+	// Sunday can be given as 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	c = &CronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	return
+
+}
+
+// parseCronField parses a field and returns a bit set of matching values.
+func parseCronField(field string, f cronField) (bits uint64, err error) {
+
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i != -1 {
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step of %v: %v", f.name, item)
+			}
+			item = item[:i]
+		}
+
+		min, max := f.min, f.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			if min, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid %v: %v", f.name, item)
+			}
+			max = min
+			if len(bounds) == 2 {
+				if max, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid %v: %v", f.name, item)
+				}
+			} else if step != 1 {
+				// a/n means from a to the end.
+				max = f.max
+			}
+		}
+		if min < f.min || max > f.max || min > max {
+			return 0, fmt.Errorf("%v is out of range: %v", f.name, item)
+		}
+		for v := min; v <= max; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return
+
+}
+
+// Next returns the first time matching the schedule after a given time; it
+// returns the zero time if there are no such times within five years.
+func (c *CronSchedule) Next(t time.Time) time.Time {
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.Add(cronSearchLimit); t.Before(limit); {
+		y, m, d := t.Date()
+		switch {
+		case c.month&(1<<uint(m)) == 0:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+
+}
+
+// Prev returns the last time matching the schedule at or before a given
+// time; it returns the zero time if there are no such times within five
+// years.
+func (c *CronSchedule) Prev(t time.Time) time.Time {
+
+	t = t.Truncate(time.Minute)
+	for limit := t.Add(-cronSearchLimit); t.After(limit); {
+		y, m, d := t.Date()
+		switch {
+		case c.month&(1<<uint(m)) == 0:
+			t = time.Date(y, m, 1, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !c.matchDay(t):
+			t = time.Date(y, m, d, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location()).Add(-time.Minute)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(-time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+
+}
+
+// matchDay returns true if the day of a given time matches the schedule.
+func (c *CronSchedule) matchDay(t time.Time) bool {
+
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+
+}
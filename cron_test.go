@@ -0,0 +1,76 @@
+//
+// cron_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+
+	for _, spec := range []string{"0 3 * * *", "*/15 9-17 * * 1-5", "0 0 1,15 * 7", "5/10 * * 1-12/3 *"} {
+		if _, err := ParseCron(spec); err != nil {
+			t.Errorf("Cannot parse %q: %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"", "0 3 * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("Invalid schedule %q is parsed", spec)
+		}
+	}
+
+}
+
+func TestCronSchedule(t *testing.T) {
+
+	// 2017-07-05 is Wednesday.
+	now := time.Date(2017, 7, 5, 10, 30, 15, 0, time.UTC)
+	cases := []struct {
+		Spec string
+		Prev time.Time
+		Next time.Time
+	}{
+		{"0 3 * * *", time.Date(2017, 7, 5, 3, 0, 0, 0, time.UTC), time.Date(2017, 7, 6, 3, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2017, 7, 5, 10, 30, 0, 0, time.UTC), time.Date(2017, 7, 6, 10, 30, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2017, 7, 5, 10, 20, 0, 0, time.UTC), time.Date(2017, 7, 5, 10, 40, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2017, 7, 2, 0, 0, 0, 0, time.UTC), time.Date(2017, 7, 9, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2017, 7, 2, 0, 0, 0, 0, time.UTC), time.Date(2017, 7, 9, 0, 0, 0, 0, time.UTC)},
+		// Either day of month or day of week matches.
+		{"0 0 1 * 5", time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2017, 7, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2017, 5, 31, 0, 0, 0, 0, time.UTC), time.Date(2017, 7, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		schedule, err := ParseCron(c.Spec)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if res := schedule.Prev(now); !res.Equal(c.Prev) {
+			t.Errorf("Previous time of %q is %v, want %v", c.Spec, res, c.Prev)
+		}
+		if res := schedule.Next(now); !res.Equal(c.Next) {
+			t.Errorf("Next time of %q is %v, want %v", c.Spec, res, c.Next)
+		}
+	}
+
+}
@@ -0,0 +1,314 @@
+//
+// datastore.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// DatastoreURL defines the URL of the Cloud Datastore API for a project.
+const DatastoreURL = "https://datastore.googleapis.com/v1/projects/%v"
+
+// ErrDatastoreConflict is returned when a transaction conflicts with another
+// one and is aborted.
+var ErrDatastoreConflict = errors.New("transaction aborted by a conflict")
+
+// DatastoreClient is a client of the Cloud Datastore REST API; it supports
+// only operations this queue manager uses.
+type DatastoreClient struct {
+	// Endpoint is the URL of the API for a project.
+	Endpoint string
+	// Project is the project ID keys belong to.
+	Project string
+	// Token returns an access token of the API.
+	Token func(ctx context.Context) (string, error)
+}
+
+// NewDatastoreClient creates a client of Cloud Datastore in a given project
+// using the access token of this instance.
+func NewDatastoreClient(project string) *DatastoreClient {
+	return &DatastoreClient{
+		Endpoint: fmt.Sprintf(DatastoreURL, project),
+		Project:  project,
+		Token:    AccessToken,
+	}
+}
+
+// DatastoreKey defines a key of an entity which has no ancestors.
+type DatastoreKey struct {
+	PartitionID struct {
+		ProjectID string `json:"projectId"`
+	} `json:"partitionId"`
+	Path []DatastorePathElement `json:"path"`
+}
+
+// DatastorePathElement defines an element of a key path.
+type DatastorePathElement struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// DatastoreValue defines a value of a property; only one field is set.
+type DatastoreValue struct {
+	StringValue        *string `json:"stringValue,omitempty"`
+	IntegerValue       *string `json:"integerValue,omitempty"`
+	TimestampValue     *string `json:"timestampValue,omitempty"`
+	ExcludeFromIndexes bool    `json:"excludeFromIndexes,omitempty"`
+}
+
+// DatastoreEntity defines an entity.
+type DatastoreEntity struct {
+	Key        *DatastoreKey             `json:"key"`
+	Properties map[string]DatastoreValue `json:"properties"`
+}
+
+// Key returns a key of a given kind and name.
+func (c *DatastoreClient) Key(kind, name string) *DatastoreKey {
+	key := &DatastoreKey{
+		Path: []DatastorePathElement{
+			{Kind: kind, Name: name},
+		},
+	}
+	key.PartitionID.ProjectID = c.Project
+	return key
+}
+
+// StringValue returns a string value.
+func StringValue(v string, noindex bool) DatastoreValue {
+	return DatastoreValue{StringValue: &v, ExcludeFromIndexes: noindex}
+}
+
+// IntegerValue returns an integer value.
+func IntegerValue(v int64) DatastoreValue {
+	str := strconv.FormatInt(v, 10)
+	return DatastoreValue{IntegerValue: &str}
+}
+
+// TimestampValue returns a timestamp value.
+func TimestampValue(v time.Time) DatastoreValue {
+	str := v.UTC().Format(time.RFC3339Nano)
+	return DatastoreValue{TimestampValue: &str}
+}
+
+// String returns a string property of an entity, or an empty string if the
+// entity doesn't have it.
+func (e *DatastoreEntity) String(name string) string {
+	if v, ok := e.Properties[name]; ok && v.StringValue != nil {
+		return *v.StringValue
+	}
+	return ""
+}
+
+// Integer returns an integer property of an entity, or 0 if the entity
+// doesn't have it.
+func (e *DatastoreEntity) Integer(name string) int64 {
+	if v, ok := e.Properties[name]; ok && v.IntegerValue != nil {
+		i, _ := strconv.ParseInt(*v.IntegerValue, 10, 64)
+		return i
+	}
+	return 0
+}
+
+// Timestamp returns a timestamp property of an entity, or the zero time if
+// the entity doesn't have it.
+func (e *DatastoreEntity) Timestamp(name string) time.Time {
+	if v, ok := e.Properties[name]; ok && v.TimestampValue != nil {
+		t, _ := time.Parse(time.RFC3339Nano, *v.TimestampValue)
+		return t
+	}
+	return time.Time{}
+}
+
+// Query returns all entities of a kind whose property equals a given value.
+func (c *DatastoreClient) Query(ctx context.Context, kind, property string, value DatastoreValue) (entities []*DatastoreEntity, err error) {
+
+	var cursor string
+	for {
+		query := map[string]interface{}{
+			"kind": []map[string]string{
+				{"name": kind},
+			},
+			"filter": map[string]interface{}{
+				"propertyFilter": map[string]interface{}{
+					"property": map[string]string{"name": property},
+					"op":       "EQUAL",
+					"value":    value,
+				},
+			},
+		}
+		if cursor != "" {
+			query["startCursor"] = cursor
+		}
+		var res struct {
+			Batch struct {
+				EntityResults []struct {
+					Entity *DatastoreEntity `json:"entity"`
+				} `json:"entityResults"`
+				EndCursor   string `json:"endCursor"`
+				MoreResults string `json:"moreResults"`
+			} `json:"batch"`
+		}
+		err = c.call(ctx, "runQuery", map[string]interface{}{
+			"partitionId": map[string]string{"projectId": c.Project},
+			"query":       query,
+		}, &res)
+		if err != nil {
+			return
+		}
+		for _, r := range res.Batch.EntityResults {
+			entities = append(entities, r.Entity)
+		}
+		if res.Batch.MoreResults != "NOT_FINISHED" || len(res.Batch.EntityResults) == 0 {
+			return
+		}
+		cursor = res.Batch.EndCursor
+	}
+
+}
+
+// Lookup returns an entity of a given key; it returns nil if the entity
+// doesn't exist.
+func (c *DatastoreClient) Lookup(ctx context.Context, key *DatastoreKey) (*DatastoreEntity, error) {
+	return c.lookup(ctx, key, map[string]string{})
+}
+
+// lookup returns an entity of a given key with read options.
+func (c *DatastoreClient) lookup(ctx context.Context, key *DatastoreKey, options map[string]string) (entity *DatastoreEntity, err error) {
+
+	var found struct {
+		Found []struct {
+			Entity *DatastoreEntity `json:"entity"`
+		} `json:"found"`
+	}
+	err = c.call(ctx, "lookup", map[string]interface{}{
+		"readOptions": options,
+		"keys":        []*DatastoreKey{key},
+	}, &found)
+	if err != nil || len(found.Found) == 0 {
+		return
+	}
+	return found.Found[0].Entity, nil
+
+}
+
+// Update runs a transaction which reads an entity of a given key and writes
+// the entity returned by a given function; the function receives nil if the
+// entity doesn't exist, and nothing is written if it returns nil.
+// ErrDatastoreConflict is returned if another transaction updates the entity
+// at the same time.
+func (c *DatastoreClient) Update(ctx context.Context, key *DatastoreKey, update func(*DatastoreEntity) *DatastoreEntity) (err error) {
+
+	var tx struct {
+		Transaction string `json:"transaction"`
+	}
+	if err = c.call(ctx, "beginTransaction", map[string]interface{}{}, &tx); err != nil {
+		return
+	}
+
+	entity, err := c.lookup(ctx, key, map[string]string{"transaction": tx.Transaction})
+	if err != nil {
+		return
+	}
+
+	mutations := []map[string]interface{}{}
+	if entity = update(entity); entity != nil {
+		mutations = append(mutations, map[string]interface{}{"upsert": entity})
+	}
+	return c.call(ctx, "commit", map[string]interface{}{
+		"mode":        "TRANSACTIONAL",
+		"transaction": tx.Transaction,
+		"mutations":   mutations,
+	}, nil)
+
+}
+
+// Upsert writes an entity.
+func (c *DatastoreClient) Upsert(ctx context.Context, entity *DatastoreEntity) error {
+	return c.call(ctx, "commit", map[string]interface{}{
+		"mode": "NON_TRANSACTIONAL",
+		"mutations": []map[string]interface{}{
+			{"upsert": entity},
+		},
+	}, nil)
+}
+
+// Delete deletes an entity of a given key; it is not an error if the entity
+// doesn't exist.
+func (c *DatastoreClient) Delete(ctx context.Context, key *DatastoreKey) error {
+	return c.call(ctx, "commit", map[string]interface{}{
+		"mode": "NON_TRANSACTIONAL",
+		"mutations": []map[string]interface{}{
+			{"delete": key},
+		},
+	}, nil)
+}
+
+// call calls a method of the API with a request body and decodes the
+// response into out unless it is nil.
+func (c *DatastoreClient) call(ctx context.Context, method string, in, out interface{}) (err error) {
+
+	token, err := c.Token(ctx)
+	if err != nil {
+		return
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, c.Endpoint+":"+method, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := ctxhttp.Do(ctx, nil, req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return
+	}
+	switch {
+	case res.StatusCode == http.StatusConflict:
+		return ErrDatastoreConflict
+	case res.StatusCode != http.StatusOK:
+		return fmt.Errorf("cannot call %v of Cloud Datastore: %v %v", method, res.Status, string(data))
+	}
+	if out == nil {
+		return
+	}
+	return json.Unmarshal(data, out)
+
+}
@@ -0,0 +1,149 @@
+//
+// dependency.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DependencyWaitInterval defines how long the queue manager waits before
+	// fetching tasks again after every fetched task is waiting for
+	// dependencies or its scheduled time.
+	DependencyWaitInterval = 30 * time.Second
+	// DependencyWaitTimeout defines how long the queue manager keeps waiting
+	// while no fetched tasks can run; it stops after that, leaving the tasks
+	// in their queues.
+	DependencyWaitTimeout = time.Hour
+)
+
+// DependencyError is returned when a task a script depends on has ended
+// without succeeding, so that the script will never run.
+type DependencyError struct {
+	// Name of the task the script depends on.
+	Name string
+	// Status of the task.
+	Status string
+}
+
+// Error returns a message of this error.
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("dependency %v ended with status %v", e.Name, e.Status)
+}
+
+// holdReason returns why a task cannot run in this instance now; the empty
+// string means it can run. wait is true if the task will be able to run
+// later.
+func holdReason(ctx context.Context, cfg *Config, s *Script, now time.Time) (reason string, wait bool, err error) {
+
+	if missing := cfg.Labels.Missing(s.Requires); len(missing) != 0 {
+		return fmt.Sprintf("requires labels %v", strings.Join(missing, ", ")), false, nil
+	}
+	if s.NotBefore != nil && now.Before(*s.NotBefore) {
+		return fmt.Sprintf("is scheduled at %v", s.NotBefore.Format(time.RFC3339)), true, nil
+	}
+	waiting, err := WaitingDependencies(ctx, cfg.Results, s)
+	if err != nil || len(waiting) == 0 {
+		return
+	}
+	return fmt.Sprintf("is waiting for %v", strings.Join(waiting, ", ")), true, nil
+
+}
+
+// WaitingDependencies returns names of tasks a script depends on but which
+// haven't ended yet according to results in a given store; a matrix task
+// which enqueued child tasks is waited through the children. A
+// DependencyError is returned if one of them has failed, timed out, or
+// expired.
+func WaitingDependencies(ctx context.Context, store ResultStore, s *Script) (waiting []string, err error) {
+
+	if len(s.DependsOn) == 0 {
+		return
+	}
+	if store == nil {
+		return nil, fmt.Errorf("no result store to check dependencies of %v", s.Name)
+	}
+
+	for _, name := range s.DependsOn {
+		var w []string
+		if w, err = waitingTasks(ctx, store, name); err != nil {
+			return nil, err
+		}
+		waiting = append(waiting, w...)
+	}
+	return
+
+}
+
+// waitingTasks returns a given task if it hasn't ended yet, or its children
+// which haven't ended if it enqueued child tasks.
+func waitingTasks(ctx context.Context, store ResultStore, name string) (waiting []string, err error) {
+
+	res, err := store.Get(ctx, name)
+	if err != nil {
+		return
+	}
+	switch {
+	case res == nil:
+		waiting = []string{name}
+	case res.Status == TaskEnqueued:
+		for _, child := range res.Children {
+			var w []string
+			if w, err = waitingTasks(ctx, store, child); err != nil {
+				return nil, err
+			}
+			waiting = append(waiting, w...)
+		}
+	case res.Status != TaskSucceeded:
+		err = &DependencyError{Name: name, Status: res.Status}
+	}
+	return
+
+}
+
+// releaseTask puts a fetched task back to its queue so that it is fetched
+// again later; the task stays in the queue so that it isn't lost if releasing
+// fails.
+func releaseTask(ctx context.Context, backend QueueBackend, task *Task) error {
+	return backend.Release(ctx, task)
+}
+
+// failTask records a script is dropped since it cannot run.
+func failTask(ctx context.Context, cfg *Config, s *Script, reason error) error {
+
+	if cfg.Results == nil {
+		return nil
+	}
+	now := time.Now()
+	return cfg.Results.Put(ctx, &TaskResult{
+		Name:       s.Name,
+		Params:     s.Params,
+		Status:     TaskFailed,
+		Error:      reason.Error(),
+		StartedAt:  now,
+		FinishedAt: now,
+	})
+
+}
@@ -0,0 +1,218 @@
+//
+// dependency_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWaitingDependencies(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	store := &FileResultStore{Dir: dir}
+	for _, res := range []*TaskResult{
+		&TaskResult{Name: "prepare", Status: TaskSucceeded},
+		&TaskResult{Name: "train", Status: TaskFailed},
+	} {
+		if err = store.Put(ctx, res); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	s := &Script{
+		Name:      "evaluate",
+		DependsOn: []string{"prepare", "test"},
+	}
+	waiting, err := WaitingDependencies(ctx, store, s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expect := []string{"test"}; !reflect.DeepEqual(waiting, expect) {
+		t.Errorf("Waiting dependencies are %v, want %v", waiting, expect)
+	}
+
+	// A script depending on a failed task will never run.
+	s.DependsOn = append(s.DependsOn, "train")
+	_, err = WaitingDependencies(ctx, store, s)
+	if e, ok := err.(*DependencyError); !ok || e.Name != "train" || e.Status != TaskFailed {
+		t.Errorf("Error of a failed dependency is %v", err)
+	}
+
+	if _, err = WaitingDependencies(ctx, nil, s); err == nil {
+		t.Error("Dependencies are checked without any result stores")
+	}
+	if waiting, err = WaitingDependencies(ctx, nil, &Script{Name: "prepare"}); err != nil || len(waiting) != 0 {
+		t.Errorf("A script without dependencies is waiting for %v: %v", waiting, err)
+	}
+
+}
+
+func TestWaitingDependenciesEnqueuedMatrix(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	cfg := &Config{
+		Matrix:  MatrixEnqueue,
+		Results: &FileResultStore{Dir: dir},
+	}
+	task := &Task{
+		Name:  "train",
+		Queue: "queue1",
+		Script: &Script{
+			Name: "train",
+			Matrix: map[string][]string{
+				"lr": {"0.1", "0.01"},
+			},
+			Run: []Step{
+				Step{Command: "python train.py --lr {{matrix.lr}}"},
+			},
+		},
+	}
+	if err = runTask(ctx, new(testQueue), task, cfg, log.New(ioutil.Discard, "", 0)); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// A script depending on the matrix task waits for its children.
+	s := &Script{Name: "evaluate", DependsOn: []string{"train"}}
+	waiting, err := WaitingDependencies(ctx, cfg.Results, s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expect := []string{"train-0", "train-1"}; !reflect.DeepEqual(waiting, expect) {
+		t.Errorf("Waiting tasks are %v, want %v", waiting, expect)
+	}
+
+	if err = cfg.Results.Put(ctx, &TaskResult{Name: "train-0", Status: TaskSucceeded}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if waiting, err = WaitingDependencies(ctx, cfg.Results, s); err != nil || !reflect.DeepEqual(waiting, []string{"train-1"}) {
+		t.Errorf("Waiting tasks are %v (%v), want [train-1]", waiting, err)
+	}
+
+	if err = cfg.Results.Put(ctx, &TaskResult{Name: "train-1", Status: TaskFailed}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err = WaitingDependencies(ctx, cfg.Results, s); err == nil {
+		t.Error("Failed child task doesn't fail the dependency")
+	} else if depErr, ok := err.(*DependencyError); !ok || depErr.Name != "train-1" {
+		t.Errorf("Dependency error is %v", err)
+	}
+
+	if err = cfg.Results.Put(ctx, &TaskResult{Name: "train-1", Status: TaskSucceeded}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if waiting, err = WaitingDependencies(ctx, cfg.Results, s); err != nil || len(waiting) != 0 {
+		t.Errorf("Waiting tasks are %v (%v) after all children succeeded", waiting, err)
+	}
+
+}
+
+func TestReleaseTask(t *testing.T) {
+
+	task := &Task{
+		Name:   "evaluate",
+		Queue:  "queue1",
+		Script: &Script{Name: "evaluate"},
+	}
+	queue := &testQueue{
+		tasks: []*Task{task, &Task{Name: "train", Queue: "queue1"}},
+	}
+	if err := releaseTask(context.Background(), queue, task); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(queue.tasks) != 2 || queue.tasks[0].Name != "train" || queue.tasks[1] != task {
+		t.Errorf("Tasks in the queue are %+v", queue.tasks)
+	}
+
+	// A released task remains in the datastore queue and can be fetched
+	// again.
+	server := httptest.NewServer(new(fakeDatastore))
+	defer server.Close()
+	backend := newTestGCPQueue(server, "instance-1")
+	ctx := context.Background()
+	if err := backend.Enqueue(ctx, task); err != nil {
+		t.Fatal(err.Error())
+	}
+	fetched, err := backend.Fetch(ctx, "queue1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = releaseTask(ctx, backend, fetched); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fetched, err = backend.Fetch(ctx, "queue1"); err != nil || fetched == nil || fetched.Name != "evaluate" {
+		t.Errorf("Released task is fetched as %+v (%v)", fetched, err)
+	}
+
+}
+
+func TestHoldReason(t *testing.T) {
+
+	ctx := context.Background()
+	now := time.Date(2017, 7, 5, 10, 30, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	cfg := &Config{
+		Labels:  Labels{"gpu": ""},
+		Results: &FileResultStore{Dir: "/nonexistent"},
+	}
+
+	cases := []struct {
+		Script *Script
+		Hold   bool
+		Wait   bool
+	}{
+		{&Script{}, false, false},
+		{&Script{Requires: []string{"gpu"}}, false, false},
+		{&Script{Requires: []string{"tpu"}}, true, false},
+		{&Script{NotBefore: &now}, false, false},
+		{&Script{NotBefore: &later}, true, true},
+		{&Script{DependsOn: []string{"train"}}, true, true},
+	}
+	for _, c := range cases {
+		reason, wait, err := holdReason(ctx, cfg, c.Script, now)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if (reason != "") != c.Hold || wait != c.Wait {
+			t.Errorf("Script %+v is held by %q (wait = %v)", c.Script, reason, wait)
+		}
+	}
+
+}
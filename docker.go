@@ -23,17 +23,50 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"text/template"
+	"time"
+	"unicode"
 
 	"github.com/jkawamoto/roadie-queue-manager/assets"
-	"github.com/jkawamoto/roadie/script"
 )
 
 const (
 	// DefaultImage defines the default base image.
 	DefaultImage = "jkawamoto/roadie-queue-manager:latest"
+	// ImageRepository defines the repository name of images built for scripts.
+	ImageRepository = "roadie-env"
 )
 
+var (
+	// RegexpShellSafe defines a regular expression of strings which don't need
+	// to be quoted in shell scripts.
+	RegexpShellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+)
+
+// templateFuncs defines functions available in templates.
+var templateFuncs = template.FuncMap{
+	"quote": ShellQuote,
+	"path":  ShellPath,
+}
+
+// ShellQuote quotes a given string so that shell treats it as one word
+// without any expansions; strings consisting of only safe characters are
+// returned as they are.
+func ShellQuote(str string) string {
+
+	if RegexpShellSafe.MatchString(str) {
+		return str
+	}
+	return "'" + strings.Replace(str, "'", `'\''`, -1) + "'"
+
+}
+
 // loadTemplate loads a template from assets and apply given options.
 func loadTemplate(name string, opt interface{}) (res []byte, err error) {
 
@@ -42,7 +75,7 @@ func loadTemplate(name string, opt interface{}) (res []byte, err error) {
 		return
 	}
 
-	temp, err := template.New("").Parse(string(data))
+	temp, err := template.New("").Funcs(templateFuncs).Parse(string(data))
 	if err != nil {
 		return
 	}
@@ -58,33 +91,236 @@ func loadTemplate(name string, opt interface{}) (res []byte, err error) {
 
 }
 
+// ShellPath quotes a given path in sandbox containers as ShellQuote does; an
+// absolute path is prefixed with the variable RootEnv so that executors
+// running entrypoints without containers can place it in another directory.
+func ShellPath(path string) string {
+
+	if strings.HasPrefix(path, "/") {
+		return `"${` + RootEnv + `}"` + ShellQuote(path)
+	}
+	return ShellQuote(path)
+
+}
+
+// ImageName returns the name of an image built from a given Dockerfile; it is
+// tagged by a hash of the Dockerfile so that the image is shared among scripts
+// having the same environment.
+func ImageName(dockerfile []byte) string {
+	sum := sha256.Sum256(dockerfile)
+	return fmt.Sprintf("%v:%v", ImageRepository, hex.EncodeToString(sum[:])[:20])
+}
+
 // Dockerfile creates a new Dockerfile for a given script.
-func Dockerfile(s *script.Script) (res []byte, err error) {
+func Dockerfile(s *Script) (res []byte, err error) {
 
 	if s.Image == "" {
 		s.Image = DefaultImage
 	}
+	// Line breaks would inject other instructions to the Dockerfile.
+	if strings.IndexFunc(s.Image, unicode.IsSpace) != -1 || strings.IndexFunc(s.Image, unicode.IsControl) != -1 {
+		return nil, fmt.Errorf("invalid image name: %q", s.Image)
+	}
+	for _, pkg := range s.APT {
+		if strings.IndexFunc(pkg, unicode.IsControl) != -1 {
+			return nil, fmt.Errorf("invalid apt package name: %q", pkg)
+		}
+	}
 	return loadTemplate("assets/Dockerfile", s)
 
 }
 
 // DownloadOpt defines a download option for a URL.
 type DownloadOpt struct {
-	Src   string
-	Dest  string
-	Zip   bool
-	TarGz bool
-	Tar   bool
+	Src  string
+	Dest string
+	// Format is the archive format of the downloaded file; ArchiveNone means
+	// the file won't be expanded.
+	Format ArchiveFormat
+	// Keep is true if the archive file should be kept after it is expanded.
+	Keep bool
+}
+
+// GitOpt defines options to clone a git repository.
+type GitOpt struct {
+	URL string
+	// Ref is a branch or tag name to be checked out.
+	Ref string
+	// Commit is a commit hash to be checked out.
+	Commit string
+	// Depth is the number of commits to be fetched; 0 means all commits.
+	Depth int
+	// Submodules is true if submodules should be initialized.
+	Submodules bool
+	// DeployKey is the path to a SSH private key in the sandbox container.
+	DeployKey string
+	// KnownHosts is the path to a known_hosts file in the sandbox container,
+	// which has host keys of git servers accessed with the deploy key.
+	KnownHosts string
+}
+
+// SecretEnvOpt defines a secret set to an environment variable.
+type SecretEnvOpt struct {
+	// Name of the environment variable.
+	Name string
+	// Path to the file which has the secret in the sandbox container.
+	Path string
+}
+
+// RunOpt defines a run step.
+type RunOpt struct {
+	// Name of this step, which prefixes outputs of this step.
+	Name    string
+	Command string
+	// Env is a list of environment variables given as KEY=VALUE.
+	Env []string
+	// Workdir is the working directory of this step.
+	Workdir string
+	// Logs are paths to log files of this step in the sandbox container.
+	Logs *StepLogs
+	// Timeout of this step; 0 means no timeouts.
+	Timeout time.Duration
+	// Status is the path to a file the result of this step is written to.
+	Status string
+	// Parallel steps run concurrently if this step is a parallel group.
+	Parallel []RunOpt
+	// Concurrency is the max number of parallel steps running at a time;
+	// 0 means no limits.
+	Concurrency int
+}
+
+// Summary returns a description of this step.
+func (opt *RunOpt) Summary() string {
+
+	if len(opt.Parallel) == 0 {
+		return opt.Command
+	}
+	names := make([]string, len(opt.Parallel))
+	for i, step := range opt.Parallel {
+		names[i] = step.Name
+	}
+	return fmt.Sprintf("Running %v in parallel", strings.Join(names, ", "))
+
+}
+
+// CommandLine returns a shell command line which runs this step via the run
+// helper command of a given binary.
+func (opt *RunOpt) CommandLine(helper string) string {
+
+	// A parallel group runs command lines of its steps via the parallel
+	// helper command.
+	if len(opt.Parallel) != 0 {
+		args := []string{ShellPath(helper), "parallel"}
+		if opt.Concurrency != 0 {
+			args = append(args, "-concurrency", strconv.Itoa(opt.Concurrency))
+		}
+		args = append(args, "--")
+		for _, step := range opt.Parallel {
+			args = append(args, ShellQuote(step.CommandLine(helper)))
+		}
+		return strings.Join(args, " ")
+	}
+
+	// Paths are quoted by ShellPath and other arguments by ShellQuote.
+	args := []string{ShellPath(helper), "run"}
+	if opt.Name != "" {
+		args = append(args, "-name", ShellQuote(opt.Name))
+	}
+	if opt.Logs != nil {
+		for _, v := range [][]string{
+			{"-stdout", opt.Logs.Stdout},
+			{"-stderr", opt.Logs.Stderr},
+			{"-combined", opt.Logs.Combined},
+		} {
+			if v[1] != "" {
+				args = append(args, v[0], ShellPath(v[1]))
+			}
+		}
+	}
+	for _, env := range opt.Env {
+		args = append(args, "-env", ShellQuote(env))
+	}
+	if opt.Workdir != "" {
+		args = append(args, "-workdir", ShellPath(opt.Workdir))
+	}
+	if opt.Timeout != 0 {
+		args = append(args, "-timeout", ShellQuote(opt.Timeout.String()))
+	}
+	if opt.Status != "" {
+		args = append(args, "-status", ShellPath(opt.Status))
+	}
+	args = append(args, "--", "sh", "-c", ShellQuote(opt.Command))
+	return strings.Join(args, " ")
+
 }
 
 // EntrypointOpt defines options to create an entrypoint.sh.
 type EntrypointOpt struct {
-	Git       string
-	Downloads []DownloadOpt
-	GSFiles   []DownloadOpt
-	Run       []string
-	Result    string
-	Uploads   []string
+	// Helper is the path to this binary in the sandbox container.
+	Helper string
+	// Credentials is the path to a netrc file in the sandbox container.
+	Credentials string
+	// SetupDir is a writable directory which has files used only to clone and
+	// download sources; it is emptied before run steps.
+	SetupDir string
+	// SecretEnvs are secrets exported as environment variables.
+	SecretEnvs []SecretEnvOpt
+	// SecretFiles are paths to files which have secrets in the sandbox
+	// container; the secrets are masked in logs before they are uploaded.
+	SecretFiles []string
+	// MaskSalt and MaskDigests are a salt in hex and digests made by
+	// DigestSecret of secrets which are also masked in uploaded logs but
+	// aren't given to run steps.
+	MaskSalt    string
+	MaskDigests []string
+	Git         *GitOpt
+	Downloads   []DownloadOpt
+	GSFiles     []DownloadOpt
+	Run         []RunOpt
+	// OnFailure steps run if a step in Run fails.
+	OnFailure []RunOpt
+	// Finally steps always run after Run and OnFailure steps.
+	Finally []RunOpt
+	// LogDir is the directory logs of run steps are written.
+	LogDir  string
+	Result  string
+	Uploads []string
+	// StopOnFailure is true if a failed step skips the remaining steps in Run
+	// and Uploads, and the exit status of the step is returned.
+	StopOnFailure bool
+	// UploadOnFailure is true if Uploads should be uploaded even if a step fails
+	// with StopOnFailure.
+	UploadOnFailure bool
+}
+
+// Steps returns all steps except parallel groups, which are replaced with
+// their steps.
+func (opt *EntrypointOpt) Steps() (steps []RunOpt) {
+
+	for _, section := range [][]RunOpt{opt.Run, opt.OnFailure, opt.Finally} {
+		for _, step := range section {
+			if len(step.Parallel) != 0 {
+				steps = append(steps, step.Parallel...)
+			} else {
+				steps = append(steps, step)
+			}
+		}
+	}
+	return
+
+}
+
+// Hosts returns host names of URLs this entrypoint accesses via HTTP(S).
+func (opt *EntrypointOpt) Hosts() (hosts []string) {
+
+	for _, d := range opt.Downloads {
+		hosts = append(hosts, hostOf(d.Src))
+	}
+	if opt.Git != nil && strings.HasPrefix(opt.Git.URL, "http") {
+		hosts = append(hosts, hostOf(opt.Git.URL))
+	}
+	return
+
 }
 
 // Entrypoint creates a new entrypoint.sh with a given set of options.
@@ -22,16 +22,20 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
-
-	"github.com/jkawamoto/roadie/script"
+	"time"
 )
 
 func TestDockerfile(t *testing.T) {
 
-	s := &script.Script{
+	s := &Script{
 		APT: []string{
 			"package1",
 			"package2",
@@ -59,9 +63,24 @@ func TestDockerfile(t *testing.T) {
 
 }
 
+func TestDockerfileInjection(t *testing.T) {
+
+	cases := []*Script{
+		&Script{Image: "ubuntu:latest\nRUN touch /pwned"},
+		&Script{Image: "ubuntu:latest\rRUN touch /pwned"},
+		&Script{APT: []string{"git\nRUN touch /pwned"}},
+	}
+	for _, s := range cases {
+		if res, err := Dockerfile(s); err == nil {
+			t.Errorf("Dockerfile is created from a script with image %q and apt %q:\n%v", s.Image, s.APT, string(res))
+		}
+	}
+
+}
+
 func TestDockerfileWithoutApt(t *testing.T) {
 
-	s := &script.Script{}
+	s := &Script{}
 
 	buf, err := Dockerfile(s)
 	if err != nil {
@@ -81,17 +100,44 @@ func TestDockerfileWithoutApt(t *testing.T) {
 func TestEntrypoint(t *testing.T) {
 
 	data, err := Entrypoint(&EntrypointOpt{
-		Git: "https://github.com/jkawamoto/roadie-queue-manager.git",
+		Helper: HelperPath,
+		Git: &GitOpt{
+			URL: "https://github.com/jkawamoto/roadie-queue-manager.git",
+		},
 		Downloads: []DownloadOpt{
 			DownloadOpt{
 				Src:  "download-src",
 				Dest: "download-dest",
 			},
+			DownloadOpt{
+				Src:    "archive-src",
+				Dest:   "archive-dest.zip",
+				Format: ArchiveZip,
+				Keep:   true,
+			},
+		},
+		SecretEnvs: []SecretEnvOpt{
+			SecretEnvOpt{
+				Name: "API_KEY",
+				Path: SecretsPath + "/API_KEY",
+			},
+		},
+		SecretFiles: []string{
+			SecretsPath + "/API_KEY",
 		},
 		GSFiles: []DownloadOpt{},
-		Run: []string{
-			"cmd1",
+		Run: []RunOpt{
+			RunOpt{
+				Name:    "step0",
+				Command: "cmd1",
+				Logs: &StepLogs{
+					Stdout:   LogDir + "/stdout0.txt",
+					Stderr:   LogDir + "/stderr0.txt",
+					Combined: LogDir + "/log0.txt",
+				},
+			},
 		},
+		LogDir: LogDir,
 		Result: "gs://somebucket/",
 		Uploads: []string{
 			"result1",
@@ -105,15 +151,355 @@ func TestEntrypoint(t *testing.T) {
 	if !strings.Contains(entrypoint, "git clone https://github.com/jkawamoto/roadie-queue-manager.git .") {
 		t.Error("Entrypoint doesn't have a correct git repository")
 	}
-	if !strings.Contains(entrypoint, "curl -L -o download-dest download-src") {
+	if !strings.Contains(entrypoint, ShellPath(HelperPath)+" download download-src download-dest") {
 		t.Error("Entrypint doesn't have a correct download")
 	}
-	if !strings.Contains(entrypoint, `sh -c "cmd1" > /tmp/stdout0.txt`) {
+	if !strings.Contains(entrypoint, ShellPath(HelperPath)+" download -format zip -keep archive-src archive-dest.zip") {
+		t.Error("Entrypoint doesn't expand a downloaded archive")
+	}
+	if !strings.Contains(entrypoint, `export API_KEY="$(cat `+ShellPath(SecretsPath+"/API_KEY")+`)"`) {
+		t.Error("Entrypoint doesn't export a secret")
+	}
+	if !strings.Contains(entrypoint, ShellPath(HelperPath)+" run -name step0 -stdout "+ShellPath("/tmp/logs/stdout0.txt")+" -stderr "+ShellPath("/tmp/logs/stderr0.txt")+" -combined "+ShellPath("/tmp/logs/log0.txt")+" -- sh -c cmd1") {
 		t.Error("Entrypoint doesn't have a correct command")
 	}
-	if !strings.Contains(entrypoint, `gsutil -m cp "/tmp/stdout*.txt" gs://somebucket/`) {
+	if !strings.Contains(entrypoint, ShellPath(HelperPath)+" mask -secret "+ShellPath(SecretsPath+"/API_KEY")+" "+ShellPath("/tmp/logs")) {
+		t.Error("Entrypoint doesn't mask secrets in logs")
+	}
+	if !strings.Contains(entrypoint, `gsutil -m cp `+ShellPath("/tmp/logs")+`"/*" gs://somebucket/`) {
 		t.Error("Entrypoint doesn't have correct uploading")
 	}
 	t.Log(string(data))
 
 }
+
+func TestShellQuote(t *testing.T) {
+
+	cases := []string{
+		"cmd1",
+		"",
+		"echo \"hello world\"",
+		"echo 'single quoted'",
+		"echo $HOME `whoami` $(id) \\n",
+		"line1\nline2",
+		"cmd1; rm -rf / && cmd2 | cmd3 > out &",
+		"*.txt ~ {a,b} !1",
+	}
+	for _, c := range cases {
+		// printf prints the argument as it is only if the shell doesn't expand it.
+		out, err := exec.Command("sh", "-c", "printf %s "+ShellQuote(c)).Output()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(out) != c {
+			t.Errorf("Quoted %q is %q in shell", c, string(out))
+		}
+	}
+
+}
+
+func TestEntrypointQuoting(t *testing.T) {
+
+	data, err := Entrypoint(&EntrypointOpt{
+		Helper: HelperPath,
+		Downloads: []DownloadOpt{
+			DownloadOpt{
+				Src:  "https://example.com/$(touch pwned)?a=1&b=2",
+				Dest: "dest dir/file",
+			},
+		},
+		Run: []RunOpt{
+			RunOpt{Command: `echo "Hello, $USER"`},
+			RunOpt{
+				Command: "python -c 'print(1)'\necho done",
+				Name:    "step1",
+				Env:     []string{"GREETING=hello world", "LC_ALL=C"},
+				Workdir: "src",
+				Timeout: time.Minute,
+				Status:  StatusPath + "/step1.json",
+			},
+		},
+		Result: "gs://somebucket/;reboot",
+		Uploads: []string{
+			"*.csv",
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	entrypoint := string(data)
+	if !strings.Contains(entrypoint, HelperPath+` download 'https://example.com/$(touch pwned)?a=1&b=2' 'dest dir/file'`) {
+		t.Error("Entrypoint doesn't quote a download URL")
+	}
+	if !strings.Contains(entrypoint, `run -- sh -c 'echo "Hello, $USER"'`) {
+		t.Error("Entrypoint doesn't quote a command having double quotes")
+	}
+	if !strings.Contains(entrypoint, "-- sh -c 'python -c '\\''print(1)'\\''\necho done'") {
+		t.Error("Entrypoint doesn't quote a command having single quotes and new lines")
+	}
+	if !strings.Contains(entrypoint, `gsutil -m cp '*.csv' 'gs://somebucket/;reboot'`) {
+		t.Error("Entrypoint doesn't quote uploading")
+	}
+	if !strings.Contains(entrypoint, "-name step1 -env 'GREETING=hello world' -env LC_ALL=C -workdir src -timeout 1m0s") {
+		t.Error("Entrypoint doesn't set environment variables and a working directory of the step")
+	}
+	if !strings.Contains(entrypoint, "-timeout 1m0s -status "+ShellPath(StatusPath+"/step1.json")+" -- sh -c") {
+		t.Error("Entrypoint doesn't set a timeout of the step")
+	}
+	if err = exec.Command("bash", "-n", "-c", entrypoint).Run(); err != nil {
+		t.Errorf("Entrypoint has a syntax error: %v", err)
+	}
+
+}
+
+func TestEntrypointGit(t *testing.T) {
+
+	data, err := Entrypoint(&EntrypointOpt{
+		Git: &GitOpt{
+			URL:        "ssh://git@github.com/jkawamoto/roadie-queue-manager.git",
+			Ref:        "v0.2.3",
+			Depth:      1,
+			Submodules: true,
+			DeployKey:  DeployKeyPath,
+			KnownHosts: KnownHostsPath,
+		},
+		SetupDir: SetupPath,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	entrypoint := string(data)
+	if !strings.Contains(entrypoint, "git clone --depth 1 --branch v0.2.3 ssh://git@github.com/jkawamoto/roadie-queue-manager.git .") {
+		t.Error("Entrypoint doesn't have a correct shallow clone")
+	}
+	if !strings.Contains(entrypoint, "git submodule update --init --recursive --depth 1") {
+		t.Error("Entrypoint doesn't initialize submodules")
+	}
+	if !strings.Contains(entrypoint, "ssh -i "+ShellPath(DeployKeyPath)+" -o IdentitiesOnly=yes -o UserKnownHostsFile="+ShellPath(KnownHostsPath)+" -o StrictHostKeyChecking=yes") {
+		t.Error("Entrypoint doesn't use the deploy key with the known_hosts file")
+	}
+	if setup, run := strings.Index(entrypoint, "rm -rf "+ShellPath(SetupPath)+"/*"), strings.Index(entrypoint, "Running commands"); setup == -1 || setup > run {
+		t.Error("Entrypoint doesn't remove the deploy key before run steps")
+	}
+
+	data, err = Entrypoint(&EntrypointOpt{
+		Helper:      HelperPath,
+		Credentials: CredentialsPath,
+		SetupDir:    SetupPath,
+		Git: &GitOpt{
+			URL:    "https://github.com/jkawamoto/roadie-queue-manager.git",
+			Commit: "2071ac6",
+			Depth:  1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	entrypoint = string(data)
+	if !strings.Contains(entrypoint, "git fetch --depth 1 origin 2071ac6") {
+		t.Error("Entrypoint doesn't fetch the given commit")
+	}
+	if strings.Contains(entrypoint, "deploy_key") {
+		t.Error("Entrypoint uses a deploy key which isn't given")
+	}
+	if !strings.Contains(entrypoint, "!"+ShellPath(HelperPath)+" credential -netrc "+ShellPath(CredentialsPath)) {
+		t.Error("Entrypoint doesn't use the credential helper")
+	}
+	if !strings.Contains(entrypoint, "git config --global --unset credential.helper") {
+		t.Error("Entrypoint doesn't stop using the credential helper before run steps")
+	}
+
+}
+
+func TestEntrypointFailure(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake helper and gsutil commands record how they are called.
+	for name, script := range map[string]string{
+		"helper": "#!/bin/sh\nwhile [ \"$1\" != -- ]; do shift; done\nshift\nexec \"$@\"\n",
+		"gsutil": "#!/bin/sh\necho \"gsutil $*\" >> calls.txt\n",
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	for _, uploadOnFailure := range []bool{false, true} {
+		os.Remove(filepath.Join(dir, "calls.txt"))
+		data, err := Entrypoint(&EntrypointOpt{
+			Helper: filepath.Join(dir, "helper"),
+			Run: []RunOpt{
+				RunOpt{Command: "echo run1 >> calls.txt"},
+				RunOpt{Command: "echo run2 >> calls.txt; exit 3"},
+				RunOpt{Command: "echo run3 >> calls.txt"},
+			},
+			OnFailure: []RunOpt{
+				RunOpt{Command: "echo on_failure >> calls.txt"},
+			},
+			Finally: []RunOpt{
+				RunOpt{Command: "echo finally >> calls.txt"},
+			},
+			LogDir:          filepath.Join(dir, "logs"),
+			Result:          "gs://somebucket/",
+			Uploads:         []string{"result.csv"},
+			StopOnFailure:   true,
+			UploadOnFailure: uploadOnFailure,
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		cmd := exec.Command("bash", "-c", string(data))
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"))
+		err = cmd.Run()
+		if status := exitStatus(err); status != 3 {
+			t.Errorf("Exit status is %v, want 3", status)
+		}
+
+		calls, err := ioutil.ReadFile(filepath.Join(dir, "calls.txt"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		expect := "run1\nrun2\non_failure\nfinally\n"
+		if uploadOnFailure {
+			expect += "gsutil -m cp result.csv gs://somebucket/\n"
+		}
+		if string(calls) != expect {
+			t.Errorf("Called commands are %q, want %q", string(calls), expect)
+		}
+	}
+
+}
+
+func TestEntrypointFailureWithoutStop(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	for name, script := range map[string]string{
+		"helper": "#!/bin/sh\nwhile [ \"$1\" != -- ]; do shift; done\nshift\nexec \"$@\"\n",
+		"gsutil": "#!/bin/sh\necho \"gsutil $*\" >> calls.txt\n",
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	// A script written before stop_on_failure runs all steps and uploads
+	// results even if a step fails.
+	s := &Script{
+		Name: "old",
+		Run: []Step{
+			Step{Command: "echo run1 >> calls.txt"},
+			Step{Command: "echo run2 >> calls.txt; exit 3"},
+			Step{Command: "echo run3 >> calls.txt"},
+		},
+		OnFailure: []Step{
+			Step{Command: "echo on_failure >> calls.txt"},
+		},
+		Result: "gs://somebucket/",
+		Upload: []string{"result.csv"},
+	}
+	opt, err := newEntrypointOpt(s, &Config{}, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	opt.Helper = filepath.Join(dir, "helper")
+	opt.LogDir = filepath.Join(dir, "logs")
+	data, err := Entrypoint(opt)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cmd := exec.Command("bash", "-c", string(data))
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"))
+	if err = cmd.Run(); err != nil {
+		t.Errorf("Entrypoint fails: %v", err)
+	}
+
+	calls, err := ioutil.ReadFile(filepath.Join(dir, "calls.txt"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expect := "run1\nrun2\nrun3\non_failure\ngsutil -m cp result.csv gs://somebucket/\n"; string(calls) != expect {
+		t.Errorf("Called commands are %q, want %q", string(calls), expect)
+	}
+
+}
+
+func TestRunOptCommandLine(t *testing.T) {
+
+	opt := &RunOpt{
+		Parallel: []RunOpt{
+			RunOpt{Name: "step0", Command: "echo $HOME"},
+			RunOpt{Name: "step1", Command: "cmd2"},
+		},
+		Concurrency: 2,
+	}
+	helper := ShellPath(HelperPath)
+	expect := helper + ` parallel -concurrency 2 -- ` + ShellQuote(helper+` run -name step0 -- sh -c 'echo $HOME'`) + ` ` + ShellQuote(helper+` run -name step1 -- sh -c cmd2`)
+	if res := opt.CommandLine(HelperPath); res != expect {
+		t.Errorf("Command line is %v, want %v", res, expect)
+	}
+	if res := opt.Summary(); res != "Running step0, step1 in parallel" {
+		t.Errorf("Summary is %v", res)
+	}
+
+	// The command line of each step must be passed to the helper as it is.
+	out, err := exec.Command("sh", "-c", `printf '%s\n' `+opt.CommandLine("helper")).Output()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	expects := []string{
+		"helper", "parallel", "-concurrency", "2", "--",
+		"helper run -name step0 -- sh -c 'echo $HOME'",
+		"helper run -name step1 -- sh -c cmd2",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expects, "\n") {
+		t.Errorf("Arguments are %q, want %q", lines, expects)
+	}
+
+}
+
+func TestImageName(t *testing.T) {
+
+	dockerfile, err := Dockerfile(&Script{Image: "python:3", APT: []string{"libgomp1"}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !bytes.Contains(dockerfile, []byte(EntrypointPath)) {
+		t.Errorf("Dockerfile doesn't use the mounted entrypoint: %s", dockerfile)
+	}
+	name := ImageName(dockerfile)
+	if !strings.HasPrefix(name, ImageRepository+":") {
+		t.Errorf("Image name %v isn't in repository %v", name, ImageRepository)
+	}
+
+	same, err := Dockerfile(&Script{Name: "another", Image: "python:3", APT: []string{"libgomp1"}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res := ImageName(same); res != name {
+		t.Errorf("Image names of the same Dockerfile are %v and %v", name, res)
+	}
+	other, err := Dockerfile(&Script{Image: "python:3"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res := ImageName(other); res == name {
+		t.Errorf("Image names of different Dockerfiles are the same: %v", res)
+	}
+
+}
@@ -0,0 +1,81 @@
+//
+// download.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Download fetches a file from a given URL and stores it to a given path.
+//
+// Compressed transfer encodings, i.e. Content-Encoding: gzip, are decoded
+// transparently, and the stored file has the same contents as the original
+// one. The destination file is replaced only if the download succeeds.
+// If the given store has a credential for the host, it is used.
+func Download(ctx context.Context, src, dest string, store CredentialStore) (err error) {
+
+	req, err := http.NewRequest(http.MethodGet, src, nil)
+	if err != nil {
+		return
+	}
+	store.Authorize(req)
+	res, err := ctxhttp.Do(ctx, nil, req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("cannot download %v: %v", redactURL(src), res.Status)
+	}
+
+	dir := filepath.Dir(dest)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	fp, err := ioutil.TempFile(dir, ".download")
+	if err != nil {
+		return
+	}
+	defer os.Remove(fp.Name())
+
+	_, err = io.Copy(fp, res.Body)
+	if e := fp.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err != nil {
+		return
+	}
+	if err = os.Chmod(fp.Name(), 0644); err != nil {
+		return
+	}
+	return os.Rename(fp.Name(), dest)
+
+}
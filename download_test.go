@@ -0,0 +1,132 @@
+//
+// download_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownload(t *testing.T) {
+
+	body := "sample file"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/plain.txt":
+			w.Write([]byte(body))
+
+		case "/encoded.txt":
+			// Send the file with gzip encoding if the client accepts it.
+			if !strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+				w.Write([]byte(body))
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(body))
+			gz.Close()
+
+		default:
+			http.NotFound(w, req)
+
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"plain.txt", "encoded.txt"} {
+		dest := filepath.Join(dir, "sub", name)
+		if err = Download(context.Background(), server.URL+"/"+name, dest, nil); err != nil {
+			t.Errorf("Cannot download %v: %v", name, err)
+			continue
+		}
+		data, err := ioutil.ReadFile(dest)
+		if err != nil {
+			t.Error(err.Error())
+		} else if string(data) != body {
+			t.Errorf("Downloaded %v is %q, want %q", name, string(data), body)
+		}
+	}
+
+	dest := filepath.Join(dir, "missing.txt")
+	if err = Download(context.Background(), server.URL+"/missing.txt", dest, nil); err == nil {
+		t.Error("Downloading a missing file doesn't return any errors")
+	}
+	if _, err = os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("A file is created even if the download failed")
+	}
+
+}
+
+func TestDownloadWithCredentials(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/token.txt":
+			if req.Header.Get("Authorization") != "Bearer secret-token" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		case "/basic.txt":
+			if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		w.Write([]byte("private"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	host := hostOf(server.URL)
+	cases := map[string]*Credential{
+		"token.txt": &Credential{Token: "secret-token"},
+		"basic.txt": &Credential{Login: "user", Password: "secret"},
+	}
+	for name, c := range cases {
+		dest := filepath.Join(dir, name)
+		if err = Download(context.Background(), server.URL+"/"+name, dest, nil); err == nil {
+			t.Errorf("%v is downloaded without any credentials", name)
+		}
+		if err = Download(context.Background(), server.URL+"/"+name, dest, CredentialStore{host: c}); err != nil {
+			t.Errorf("Cannot download %v with a credential: %v", name, err)
+		}
+	}
+
+}
@@ -23,67 +23,456 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/jkawamoto/roadie-azure/roadie"
-	"github.com/jkawamoto/roadie/script"
+	"github.com/docker/docker/api/types/mount"
 )
 
 var (
+	// RegexpCommitHash defines a regular expression of a (possibly abbreviated) commit hash.
+	RegexpCommitHash = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+	// DefaultEnv defines environment variables set in sandbox containers by
+	// default; scripts can override them.
+	DefaultEnv = map[string]string{
+		"LC_ALL": "C",
+	}
+	// RegexpStepName defines a regular expression of valid step names.
+	RegexpStepName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
 	// RegexpDropboxURL defines a regular expression of a dropbox URL.
 	RegexpDropboxURL = regexp.MustCompile(`dropbox://(?:www.dropbox.com/)?(sh?)/([^?]+)(?:\?[^:]+)?(:.*)?`)
 	// DefaultDropboxArchive defines a default file name for archive files downloaded from dropbox.
 	DefaultDropboxArchive = "dropbox.zip"
 )
 
-// ExecuteScript creates a sandbox container and runs a given script in the container.
-func ExecuteScript(ctx context.Context, s *script.Script, logger *log.Logger) (err error) {
+const (
+	// HelperPath defines the path this binary is mounted in sandbox containers
+	// so that entrypoint.sh can run helper commands.
+	HelperPath = "/roadie/bin/roadie-queue-manager"
+	// SetupPath defines the writable directory files used only to clone and
+	// download sources are mounted in sandbox containers; entrypoint.sh empties
+	// it before run steps.
+	SetupPath = "/roadie/setup"
+	// DeployKeyPath defines the path the deploy key is copied in sandbox containers.
+	DeployKeyPath = SetupPath + "/deploy_key"
+	// KnownHostsPath defines the path the known_hosts file is copied in sandbox
+	// containers.
+	KnownHostsPath = SetupPath + "/known_hosts"
+	// CredentialsPath defines the path a netrc file is copied in sandbox containers.
+	CredentialsPath = SetupPath + "/netrc"
+	// SecretsPath defines the directory secrets set to environment variables
+	// are mounted in sandbox containers.
+	SecretsPath = "/roadie/secrets"
+	// TimestampFormat defines the format of the timestamp variable.
+	TimestampFormat = "20060102-150405"
+	// EntrypointPath defines the path entrypoint.sh is mounted in sandbox
+	// containers; assets/Dockerfile refers it.
+	EntrypointPath = "/roadie/entrypoint.sh"
+	// StatusPath defines the directory results of steps are written in
+	// sandbox containers.
+	StatusPath = "/roadie/status"
+	// RootEnv defines the environment variable prefixing paths in sandbox
+	// containers which entrypoint.sh uses; it is empty in containers, and
+	// executors running entrypoints without containers set it to a directory
+	// having those paths.
+	RootEnv = "ROADIE_ROOT"
+)
+
+// ExecuteScript creates a sandbox container and runs a given script in the
+// container; the result is returned and stored in the result store of the
+// config.
+func ExecuteScript(ctx context.Context, s *Script, cfg *Config, logger *log.Logger) (res *TaskResult, err error) {
+
+	res = &TaskResult{
+		Name:      s.Name,
+		Params:    s.Params,
+		StartedAt: time.Now(),
+	}
+	defer func() {
+		res.FinishedAt = time.Now()
+		if err != nil {
+			res.Error = err.Error()
+		}
+		if res.Status == "" {
+			res.Status = taskStatus(res.Steps, err)
+		}
+		logger.Println("Task", s.Name, res.Status)
+		if cfg.Results == nil {
+			return
+		}
+		if e := cfg.Results.Put(context.Background(), res); e != nil {
+			logger.Println("Cannot store the result of task", s.Name, ":", e.Error())
+		}
+	}()
+
+	// Secrets are resolved first so that they are masked in any logs.
+	secrets, err := ResolveSecrets(ctx, cfg.Secrets, s.Secrets)
+	if err != nil {
+		return
+	}
+	// Credentials are also masked though they are given only while sources
+	// are downloaded.
+	masked := append(append([][]byte{}, secrets...), cfg.Credentials.Secrets()...)
+	logger = NewMaskedLogger(logger, masked)
 
 	logger.Println("Creating a Dockerfile and an entrypoint.sh")
 	dockerfile, err := Dockerfile(s)
 	if err != nil {
 		return
 	}
-	entrypoint, err := Entrypoint(newEntrypointOpt(s))
+	// The attempt number is counted from the previous result.
+	res.Attempt = 1
+	if cfg.Results != nil {
+		if prev, e := cfg.Results.Get(ctx, s.Name); e == nil && prev != nil {
+			res.Attempt = prev.Attempt + 1
+		}
+	}
+
+	if res.CacheKey, err = s.CacheKey(); err != nil {
+		return
+	}
+
+	executor := cfg.Executor
+	if executor == nil {
+		executor = &DockerExecutor{}
+	}
+	// A container of the script still running after a restart is waited for
+	// instead of running the script again.
+	if adopted, e := adoptContainer(ctx, executor, s, cfg, res, masked, logger); e != nil || adopted {
+		err = e
+		return
+	}
+
+	// A succeeded run of the same script is reused if the script enables the
+	// cache unless forced to rerun.
+	if s.Cache && !cfg.Force {
+		cached, e := cachedResult(ctx, cfg.Results, res.CacheKey)
+		if e != nil {
+			logger.Println("Cannot check cached results:", e.Error())
+		} else if cached != nil {
+			logger.Println("Reusing results of task", cached.Name, "in", cached.Result)
+			res.Status = TaskSucceeded
+			res.Result = cached.Result
+			res.CachedFrom = cached.Name
+			return
+		}
+	}
+
+	opt, err := newEntrypointOpt(s, cfg, BuiltinVariables(s, cfg, res.StartedAt, res.Attempt))
+	if err != nil {
+		return
+	}
+	res.Result = opt.Result
+
+	helper, err := os.Executable()
 	if err != nil {
 		return
 	}
+	mounts := []mount.Mount{
+		bindMount(helper, HelperPath),
+	}
 
-	cli, err := roadie.NewDockerClient(logger)
+	// Files passed to the sandbox container are stored in a temporary directory,
+	// which is removed after the container ends.
+	dir, err := ioutil.TempDir("", "roadie")
 	if err != nil {
 		return
 	}
-	defer cli.Close()
+	defer os.RemoveAll(dir)
+
+	// The deploy key and credentials are copied to a writable directory so that
+	// entrypoint.sh can remove them before run steps; the deploy key is given
+	// only if the source is a git repository.
+	setupDir := filepath.Join(dir, "setup")
+	if err = os.Mkdir(setupDir, 0700); err != nil {
+		return
+	}
+	if opt.Git != nil && opt.Git.DeployKey != "" {
+		if err = copyFile(cfg.DeployKey, filepath.Join(setupDir, "deploy_key")); err != nil {
+			return
+		}
+		if err = copyFile(cfg.KnownHosts, filepath.Join(setupDir, "known_hosts")); err != nil {
+			return
+		}
+		opt.SetupDir = SetupPath
+	}
+	// Credentials are passed via a file so that they don't appear in
+	// entrypoint.sh; uploaded logs are masked with their salted digests since
+	// the credentials are removed before the logs are uploaded.
+	if store := cfg.Credentials.Filter(opt.Hosts()); len(store) != 0 {
+		if err = createFile(filepath.Join(setupDir, "netrc"), store.WriteNetrc); err != nil {
+			return
+		}
+		opt.Credentials = CredentialsPath
+		opt.SetupDir = SetupPath
+
+		salt := make([]byte, 16)
+		if _, err = rand.Read(salt); err != nil {
+			return
+		}
+		opt.MaskSalt = hex.EncodeToString(salt)
+		for _, v := range store.Secrets() {
+			opt.MaskDigests = append(opt.MaskDigests, DigestSecret(salt, v))
+		}
+	}
 
-	err = cli.Build(ctx, &roadie.DockerBuildOpt{
-		ImageName:  s.Name,
-		Dockerfile: dockerfile,
-		Entrypoint: entrypoint,
+	// Secrets are also passed via files; ones set to environment variables
+	// are stored in SecretsPath and exported by entrypoint.sh.
+	secretDir := filepath.Join(dir, "secrets")
+	if err = os.Mkdir(secretDir, 0700); err != nil {
+		return
+	}
+	for i, secret := range s.Secrets {
+		write := func(w io.Writer) error {
+			_, err := w.Write(secrets[i])
+			return err
+		}
+		var m mount.Mount
+		if env := secret.EnvName(); env != "" {
+			if m, err = newFileMount(secretDir, env, filepath.Join(SecretsPath, env), write); err != nil {
+				return
+			}
+			opt.SecretEnvs = append(opt.SecretEnvs, SecretEnvOpt{
+				Name: env,
+				Path: m.Target,
+			})
+			opt.SecretFiles = append(opt.SecretFiles, m.Target)
+		}
+		if secret.File != "" {
+			if m, err = newFileMount(dir, fmt.Sprintf("secret%v", i), secret.File, write); err != nil {
+				return
+			}
+			mounts = append(mounts, m)
+			opt.SecretFiles = append(opt.SecretFiles, m.Target)
+		}
+	}
+	if len(opt.SecretEnvs) != 0 {
+		mounts = append(mounts, bindMount(secretDir, SecretsPath))
+	}
+
+	if opt.SetupDir != "" {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: setupDir,
+			Target: SetupPath,
+		})
+	}
+
+	// Results of steps are written in a writable directory.
+	statusDir := filepath.Join(dir, "status")
+	if err = os.Mkdir(statusDir, 0755); err != nil {
+		return
+	}
+	mounts = append(mounts, mount.Mount{
+		Type:   mount.TypeBind,
+		Source: statusDir,
+		Target: StatusPath,
+	})
+
+	// The entrypoint is also mounted so that the image can be shared.
+	entrypoint, err := Entrypoint(opt)
+	if err != nil {
+		return
+	}
+	m, err := newFileMount(dir, "entrypoint.sh", EntrypointPath, func(w io.Writer) error {
+		_, err := w.Write(entrypoint)
+		return err
 	})
 	if err != nil {
 		return
 	}
+	mounts = append(mounts, m)
 
-	err = cli.Start(ctx, s.Name, nil)
+	// Images are built once for each Dockerfile.
+	image := ImageName(dockerfile)
+	exist, err := executor.HasImage(ctx, image)
 	if err != nil {
 		return
 	}
+	if exist {
+		logger.Println("Using existing image", image)
+	} else {
+		logger.Println("Building image", image)
+		err = executor.Build(ctx, &BuildOpt{
+			Image:      image,
+			Dockerfile: dockerfile,
+			Logger:     logger,
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	// Labels let a restarted process find the container and its results.
+	labels := map[string]string{
+		LabelTask:      s.Name,
+		LabelStatusDir: statusDir,
+		LabelResult:    opt.Result,
+	}
+
+	// The container is killed if it doesn't end within the timeout.
+	runCtx := ctx
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+		deadline, _ := runCtx.Deadline()
+		labels[LabelDeadline] = deadline.Format(time.RFC3339)
+	}
+
+	// Outputs of the container are streamed while it is running.
+	streamer := NewOutputStreamer(runCtx, s.Name, logger, cfg.LogSink, masked)
+	stdout := streamer.Writer(StreamStdout)
+	stderr := streamer.Writer(StreamStderr)
+	err = executor.Run(runCtx, &ContainerOpt{
+		Image:      image,
+		Env:        envList(DefaultEnv, s.Env),
+		Mounts:     mounts,
+		Labels:     labels,
+		KeepFailed: cfg.Cleanup != nil && cfg.Cleanup.FailedContainers > 0,
+	}, stdout, stderr)
+	stdout.Flush()
+	stderr.Flush()
+	if runCtx.Err() == context.DeadlineExceeded {
+		res.Status = TaskTimeout
+		err = fmt.Errorf("killed because of the timeout %v", s.Timeout)
+	}
+
+	for _, step := range opt.Steps() {
+		r, e := ReadStepResult(filepath.Join(statusDir, filepath.Base(step.Status)))
+		if e != nil {
+			// The step didn't run.
+			continue
+		}
+		res.Steps = append(res.Steps, *r)
+	}
+	return
+}
+
+// taskStatus returns the status of a task from results of its steps and an
+// error occurred while running it.
+func taskStatus(steps []StepResult, err error) (status string) {
+
+	status = TaskSucceeded
+	if err != nil {
+		status = TaskFailed
+	}
+	for _, step := range steps {
+		if step.TimedOut {
+			return TaskTimeout
+		} else if step.ExitStatus != 0 {
+			status = TaskFailed
+		}
+	}
+	return
+
+}
+
+// bindMount returns a mount which binds a file in the host to a target path
+// in sandbox containers as read only.
+func bindMount(source, target string) mount.Mount {
+	return mount.Mount{
+		Type:     mount.TypeBind,
+		Source:   source,
+		Target:   target,
+		ReadOnly: true,
+	}
+}
+
+// newFileMount creates a file in a given directory with contents written by
+// a given function, and returns a mount which binds the file to a target path.
+func newFileMount(dir, name, target string, write func(w io.Writer) error) (m mount.Mount, err error) {
+
+	path := filepath.Join(dir, name)
+	if err = createFile(path, write); err != nil {
+		return
+	}
+	m = bindMount(path, target)
+	return
+
+}
+
+// createFile creates a file, which only the owner can read, with contents
+// written by a given function.
+func createFile(path string, write func(w io.Writer) error) (err error) {
 
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	err = write(fp)
+	if e := fp.Close(); e != nil && err == nil {
+		err = e
+	}
 	return
+
+}
+
+// copyFile copies a file to a given path, which only the owner can read.
+func copyFile(src, dest string) (err error) {
+
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(dest, data, 0600)
+
 }
 
-// newEntrypointOpt creates a new set of options from a given script.
-func newEntrypointOpt(s *script.Script) (opt *EntrypointOpt) {
-	opt = new(EntrypointOpt)
+// BuiltinVariables returns built-in variables of a script started at a given
+// time, which can be used in run, result, and upload sections:
+//   - task: name of the task,
+//   - queue: name of the queue the task is fetched from,
+//   - instance: name of the instance running the task,
+//   - zone: zone of the instance,
+//   - timestamp: the start time in UTC such as 20170701-120000,
+//   - attempt: how many times the task has been run including this time.
+func BuiltinVariables(s *Script, cfg *Config, start time.Time, attempt int) map[string]string {
+	return map[string]string{
+		"task":      s.Name,
+		"queue":     s.Queue,
+		"instance":  cfg.Instance,
+		"zone":      cfg.Zone,
+		"timestamp": start.UTC().Format(TimestampFormat),
+		"attempt":   strconv.Itoa(attempt),
+	}
+}
+
+// newEntrypointOpt creates a new set of options from a given script after
+// replacing given variables in it.
+func newEntrypointOpt(s *Script, cfg *Config, vars map[string]string) (opt *EntrypointOpt, err error) {
+	s = Substitute(s, vars)
+	opt = &EntrypointOpt{
+		Helper: HelperPath,
+		LogDir: LogDir,
+	}
+	if err = checkEnv(s.Env); err != nil {
+		return
+	}
 
 	// Parse source section
 	switch {
-	case strings.HasSuffix(s.Source, ".git"):
-		opt.Git = s.Source
+	case s.Source == "":
+	case isGitURL(s.Source):
+		if opt.Git, err = parseGitURL(s.Source); err != nil {
+			return
+		}
+		if cfg.DeployKey != "" {
+			opt.Git.DeployKey = DeployKeyPath
+			opt.Git.KnownHosts = KnownHostsPath
+		}
 	case strings.HasPrefix(s.Source, "gs://"):
 		opt.GSFiles = append(opt.GSFiles, parseURL(s.Source))
 	default:
@@ -99,8 +488,26 @@ func newEntrypointOpt(s *script.Script) (opt *EntrypointOpt) {
 		}
 	}
 
-	// Set running commands.
-	opt.Run = s.Run
+	// Set running commands and their log files; steps in all sections are
+	// numbered in order so that their log files have distinct names.
+	names := make(map[string]bool)
+	index := 0
+	for _, section := range []struct {
+		steps []Step
+		opts  *[]RunOpt
+	}{
+		{s.Run, &opt.Run},
+		{s.OnFailure, &opt.OnFailure},
+		{s.Finally, &opt.Finally},
+	} {
+		for _, step := range section.steps {
+			var run *RunOpt
+			if run, err = newRunOpt(step, &index, &s.Logs, names); err != nil {
+				return
+			}
+			*section.opts = append(*section.opts, *run)
+		}
+	}
 
 	// Parse result and upload section
 	opt.Result = s.Result
@@ -108,14 +515,192 @@ func newEntrypointOpt(s *script.Script) (opt *EntrypointOpt) {
 		opt.Result += "/"
 	}
 	opt.Uploads = s.Upload
+	opt.StopOnFailure = s.StopOnFailure
+	opt.UploadOnFailure = s.UploadOnFailure
+
+	return
+}
+
+// newRunOpt creates a run option of a step; index is the index of the step,
+// which is incremented for each created step, and names has names of the
+// steps created so far to check duplication.
+func newRunOpt(step Step, index *int, logNames *LogNames, names map[string]bool) (opt *RunOpt, err error) {
+
+	// Steps in a parallel group are numbered as well as other steps but the
+	// group itself isn't.
+	if len(step.Parallel) != 0 {
+		if step.Command != "" {
+			return nil, fmt.Errorf("parallel group cannot have a command: %v", step.Command)
+		}
+		opt = &RunOpt{
+			Concurrency: step.Concurrency,
+		}
+		for _, sub := range step.Parallel {
+			if len(sub.Parallel) != 0 {
+				return nil, fmt.Errorf("parallel groups cannot be nested")
+			}
+			var run *RunOpt
+			if run, err = newRunOpt(sub, index, logNames, names); err != nil {
+				return
+			}
+			opt.Parallel = append(opt.Parallel, *run)
+		}
+		return
+	}
+
+	i := *index
+	*index++
+	name := step.Name
+	if name == "" {
+		name = fmt.Sprintf("step%v", i)
+	}
+	if !RegexpStepName.MatchString(name) || names[name] {
+		return nil, fmt.Errorf("invalid or duplicated step name: %v", name)
+	}
+	names[name] = true
+	if err = checkEnv(step.Env); err != nil {
+		return
+	}
 
+	logs, err := logNames.StepLogs(i)
+	if err != nil {
+		return
+	}
+	opt = &RunOpt{
+		Name:    name,
+		Command: step.Command,
+		Env:     envList(step.Env),
+		Workdir: step.Workdir,
+		Logs:    logs,
+		Timeout: step.Timeout,
+		Status:  path.Join(StatusPath, name+".json"),
+	}
 	return
+
+}
+
+// envList merges given environment variables, where latter ones take
+// precedence, and returns them as a sorted list of KEY=VALUE.
+func envList(envs ...map[string]string) (list []string) {
+
+	merged := make(map[string]string)
+	for _, env := range envs {
+		for k, v := range env {
+			merged[k] = v
+		}
+	}
+	for k, v := range merged {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return
+
+}
+
+// checkEnv returns an error if a given set of environment variables has an
+// invalid name.
+func checkEnv(env map[string]string) error {
+	for k := range env {
+		if !RegexpEnvName.MatchString(k) {
+			return fmt.Errorf("invalid environment variable name: %v", k)
+		}
+	}
+	return nil
+}
+
+// isGitURL returns true if a given source URL points a git repository.
+func isGitURL(u string) bool {
+
+	u, _ = splitURLOptions(u)
+	for _, prefix := range []string{"git://", "git+ssh://", "git+https://", "git+http://"} {
+		if strings.HasPrefix(u, prefix) {
+			return true
+		}
+	}
+	if idx := strings.LastIndex(u, ".git@"); idx != -1 {
+		u = u[:idx+4]
+	}
+	return strings.HasSuffix(u, ".git")
+
+}
+
+// parseGitURL parses an extended git URL and returns a clone option.
+//
+// A branch, tag, or commit hash can follow the URL with @, and options
+// separated by commas can be given after #; depth=<n> makes a shallow clone
+// and submodules initializes submodules,
+// e.g. https://github.com/jkawamoto/roadie.git@v0.3.0#depth=1,submodules.
+// git+ssh:// and git+https:// URLs are cloned with ssh:// and https://.
+func parseGitURL(u string) (opt *GitOpt, err error) {
+
+	opt = new(GitOpt)
+	u, options := splitURLOptions(u)
+	for _, v := range options {
+		switch {
+		case v == "submodules":
+			opt.Submodules = true
+		case strings.HasPrefix(v, "depth="):
+			opt.Depth, err = strconv.Atoi(strings.TrimPrefix(v, "depth="))
+			if err != nil || opt.Depth < 0 {
+				return nil, fmt.Errorf("invalid depth option: %v", v)
+			}
+		}
+	}
+
+	u = strings.TrimPrefix(u, "git+")
+
+	// A reference follows .git@ or the first @ in the path of the repository,
+	// e.g. ssh://git@github.com/user/repo@feature/foo but not the user name of
+	// git@github.com:user/repo; the reference itself may have slashes.
+	var ref string
+	if idx := strings.Index(u, ".git@"); idx != -1 {
+		u, ref = u[:idx+4], u[idx+5:]
+	} else {
+		path := 0
+		if idx = strings.Index(u, "://"); idx != -1 {
+			if slash := strings.Index(u[idx+3:], "/"); slash != -1 {
+				path = idx + 3 + slash
+			} else {
+				path = len(u)
+			}
+		} else if colon := strings.Index(u, ":"); colon != -1 {
+			path = colon
+		}
+		if at := strings.Index(u[path:], "@"); at != -1 {
+			u, ref = u[:path+at], u[path+at+1:]
+		}
+	}
+	if RegexpCommitHash.MatchString(ref) {
+		opt.Commit = ref
+	} else {
+		opt.Ref = ref
+	}
+	opt.URL = u
+	return
+
 }
 
 // parseURL parses an extended URL and returns a download option.
+//
+// An extended URL may end with options separated by commas after #;
+// keep option leaves archive files after expanding them, and format=<format>
+// sets the archive format instead of guessing it from the file name,
+// e.g. http://www.sample.com/sample.zip#keep.
 func parseURL(u string) (opt DownloadOpt) {
 
-	var noExpand bool
+	u, options := splitURLOptions(u)
+	var (
+		noExpand bool
+		format   string
+	)
+	for _, v := range options {
+		switch {
+		case v == "keep":
+			opt.Keep = true
+		case strings.HasPrefix(v, "format="):
+			format = strings.TrimPrefix(v, "format=")
+		}
+	}
 	if strings.HasPrefix(u, "dropbox://") {
 		// The given URL has schema dropbox://
 		m := RegexpDropboxURL.FindStringSubmatch(u)
@@ -165,17 +750,24 @@ func parseURL(u string) (opt DownloadOpt) {
 
 	}
 
-	if !noExpand {
-		switch {
-		case strings.HasSuffix(opt.Dest, ".zip"):
-			opt.Zip = true
-		case strings.HasSuffix(opt.Dest, ".tar.gz"):
-			opt.TarGz = true
-		case strings.HasSuffix(opt.Dest, ".tar"):
-			opt.Tar = true
-		}
+	if format != "" {
+		// Unsupported formats are ignored and the file won't be expanded.
+		opt.Format, _ = ParseArchiveFormat(format)
+	} else if !noExpand {
+		opt.Format = ArchiveFormatOf(opt.Dest)
 	}
 
 	return
 
 }
+
+// splitURLOptions splits an extended URL into the URL and options given after #.
+func splitURLOptions(u string) (string, []string) {
+
+	idx := strings.LastIndex(u, "#")
+	if idx == -1 {
+		return u, nil
+	}
+	return u[:idx], strings.Split(u[idx+1:], ",")
+
+}
@@ -21,7 +21,11 @@
 
 package main
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestParseURL(t *testing.T) {
 	var opt DownloadOpt
@@ -31,8 +35,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "http://www.sample.com/sample.txt" || opt.Dest != "sample.txt" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// URL with renaming
@@ -40,8 +44,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "http://www.sample.com/sample.txt" || opt.Dest != "another.txt" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// URL with a destination folder
@@ -49,8 +53,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "http://www.sample.com/sample.txt" || opt.Dest != "/tmp/sample.txt" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// URL with renaming and a destination folder
@@ -58,8 +62,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "http://www.sample.com/sample.txt" || opt.Dest != "/tmp/another.txt" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Basic URL of a compressed file
@@ -67,8 +71,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "http://www.sample.com/sample.zip" || opt.Dest != "sample.zip" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || !opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveZip {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// URL of a compressed file with renaming
@@ -76,8 +80,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "http://www.sample.com/sample.zip" || opt.Dest != "another.zip" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// URL of a compressed file with a destination folder
@@ -85,8 +89,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "http://www.sample.com/sample.zip" || opt.Dest != "/tmp/sample.zip" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || !opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveZip {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// URL of a compressed file with renaming and a destination folder
@@ -94,8 +98,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "http://www.sample.com/sample.zip" || opt.Dest != "/tmp/another.zip" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Basic URL of a tar+gzipped file
@@ -103,8 +107,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "http://www.sample.com/sample.tar.gz" || opt.Dest != "sample.tar.gz" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || !opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveTarGz {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Basic URL of a tar file
@@ -112,8 +116,26 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "http://www.sample.com/sample.tar" || opt.Dest != "sample.tar" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if !opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveTar {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
+	}
+
+	// URL of a gzipped file
+	opt = parseURL("http://www.sample.com/sample.txt.gz")
+	if opt.Src != "http://www.sample.com/sample.txt.gz" || opt.Dest != "sample.txt.gz" {
+		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
+	}
+	if opt.Format != ArchiveGz {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
+	}
+
+	// URL of a compressed file with options
+	opt = parseURL("http://www.sample.com/sample.bin:/tmp/sample.bin#keep,format=tar.xz")
+	if opt.Src != "http://www.sample.com/sample.bin" || opt.Dest != "/tmp/sample.bin" {
+		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
+	}
+	if opt.Format != ArchiveTarXz || !opt.Keep {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v, keep: %v)", opt.Dest, opt.Format, opt.Keep)
 	}
 
 	// Dropbox URL with the host name.
@@ -121,8 +143,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "https://www.dropbox.com/s/aaaaaaaaaa/sample.txt?dl=1" || opt.Dest != "sample.txt" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Dropbox URL without the host name.
@@ -130,8 +152,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "https://www.dropbox.com/s/aaaaaaaaaa/sample.txt?dl=1" || opt.Dest != "sample.txt" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Dropbox URL with renaming.
@@ -139,8 +161,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "https://www.dropbox.com/s/aaaaaaaaaa/sample.txt?dl=1" || opt.Dest != "another.txt" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Dropbox URL with a destination directory.
@@ -148,8 +170,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "https://www.dropbox.com/s/aaaaaaaaaa/sample.txt?dl=1" || opt.Dest != "/tmp/sample.txt" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Dropbox URL with renaming and a destination directory.
@@ -157,8 +179,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "https://www.dropbox.com/s/aaaaaaaaaa/sample.txt?dl=1" || opt.Dest != "/tmp/another.txt" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Dropbox folder URL with the host name.
@@ -166,8 +188,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "https://www.dropbox.com/sh/aaaaaaaaaa/aaaaaaaaa?dl=1" || opt.Dest != "dropbox.zip" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || !opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveZip {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Dropbox folder URL without the host name.
@@ -175,8 +197,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "https://www.dropbox.com/sh/aaaaaaaaaa/aaaaaaaaa?dl=1" || opt.Dest != "dropbox.zip" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || !opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveZip {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Dropbox folder URL with renaming.
@@ -184,8 +206,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "https://www.dropbox.com/sh/aaaaaaaaaa/aaaaaaaaa?dl=1" || opt.Dest != "another.zip" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Dropbox folder URL with a destination folder.
@@ -193,8 +215,8 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "https://www.dropbox.com/sh/aaaaaaaaaa/aaaaaaaaa?dl=1" || opt.Dest != "/tmp/dropbox.zip" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || !opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveZip {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
 	}
 
 	// Dropbox folder URL with renaming and a destination folder.
@@ -202,8 +224,221 @@ func TestParseURL(t *testing.T) {
 	if opt.Src != "https://www.dropbox.com/sh/aaaaaaaaaa/aaaaaaaaa?dl=1" || opt.Dest != "/tmp/another.zip" {
 		t.Errorf("Parsed URL is not correct (src: %v, dest: %v)", opt.Src, opt.Dest)
 	}
-	if opt.Tar || opt.TarGz || opt.Zip {
-		t.Errorf("Decompress configuration is not correct (dest:%v, tar: %v, tar.gz: %v, zip: %v)", opt.Dest, opt.Tar, opt.TarGz, opt.Zip)
+	if opt.Format != ArchiveNone {
+		t.Errorf("Decompress configuration is not correct (dest: %v, format: %v)", opt.Dest, opt.Format)
+	}
+
+}
+
+func TestParseGitURL(t *testing.T) {
+
+	cases := []struct {
+		URL    string
+		Expect GitOpt
+	}{
+		{"https://github.com/jkawamoto/roadie.git", GitOpt{
+			URL: "https://github.com/jkawamoto/roadie.git",
+		}},
+		{"https://github.com/jkawamoto/roadie.git@v0.3.0", GitOpt{
+			URL: "https://github.com/jkawamoto/roadie.git",
+			Ref: "v0.3.0",
+		}},
+		{"https://github.com/jkawamoto/roadie.git@2071ac6#depth=1,submodules", GitOpt{
+			URL:        "https://github.com/jkawamoto/roadie.git",
+			Commit:     "2071ac6",
+			Depth:      1,
+			Submodules: true,
+		}},
+		{"git+ssh://git@github.com/jkawamoto/roadie@develop", GitOpt{
+			URL: "ssh://git@github.com/jkawamoto/roadie",
+			Ref: "develop",
+		}},
+		{"git@github.com:jkawamoto/roadie.git@master", GitOpt{
+			URL: "git@github.com:jkawamoto/roadie.git",
+			Ref: "master",
+		}},
+		{"https://github.com/jkawamoto/roadie.git@feature/foo", GitOpt{
+			URL: "https://github.com/jkawamoto/roadie.git",
+			Ref: "feature/foo",
+		}},
+		{"git+ssh://git@github.com/jkawamoto/roadie@feature/foo", GitOpt{
+			URL: "ssh://git@github.com/jkawamoto/roadie",
+			Ref: "feature/foo",
+		}},
+		{"git@github.com:jkawamoto/roadie.git", GitOpt{
+			URL: "git@github.com:jkawamoto/roadie.git",
+		}},
+	}
+
+	for _, c := range cases {
+		if !isGitURL(c.URL) {
+			t.Errorf("%v isn't recognized as a git repository", c.URL)
+		}
+		opt, err := parseGitURL(c.URL)
+		if err != nil {
+			t.Errorf("Cannot parse git URL %v: %v", c.URL, err)
+		} else if *opt != c.Expect {
+			t.Errorf("Parsed git URL of %v is %+v, want %+v", c.URL, *opt, c.Expect)
+		}
+	}
+	if _, err := parseGitURL("https://github.com/jkawamoto/roadie.git#depth=one"); err == nil {
+		t.Error("A git URL with an invalid depth is parsed")
+	}
+
+	if isGitURL("http://www.sample.com/sample.zip") {
+		t.Error("A zip file is recognized as a git repository")
+	}
+
+}
+
+func TestNewEntrypointOptSteps(t *testing.T) {
+
+	opt, err := newEntrypointOpt(&Script{
+		Run: []Step{
+			Step{Command: "cmd1"},
+			Step{Name: "train", Command: "cmd2"},
+		},
+		OnFailure: []Step{
+			Step{Command: "dump"},
+		},
+		Finally: []Step{
+			Step{Command: "cleanup"},
+		},
+	}, &Config{}, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Steps are numbered across sections.
+	cases := []struct {
+		Opt    RunOpt
+		Name   string
+		Stdout string
+	}{
+		{opt.Run[0], "step0", "stdout0.txt"},
+		{opt.Run[1], "train", "stdout1.txt"},
+		{opt.OnFailure[0], "step2", "stdout2.txt"},
+		{opt.Finally[0], "step3", "stdout3.txt"},
+	}
+	for _, c := range cases {
+		if c.Opt.Name != c.Name || c.Opt.Logs.Stdout != LogDir+"/"+c.Stdout || c.Opt.Status != StatusPath+"/"+c.Name+".json" {
+			t.Errorf("Step %v has name %v, log %v, and status %v", c.Opt.Command, c.Opt.Name, c.Opt.Logs.Stdout, c.Opt.Status)
+		}
+	}
+
+	_, err = newEntrypointOpt(&Script{
+		Run: []Step{
+			Step{Name: "train", Command: "cmd1"},
+		},
+		Finally: []Step{
+			Step{Name: "train", Command: "cmd2"},
+		},
+	}, &Config{}, nil)
+	if err == nil {
+		t.Error("Duplicated step names are accepted")
+	}
+
+}
+
+func TestEnvList(t *testing.T) {
+
+	res := envList(DefaultEnv, map[string]string{
+		"LC_ALL": "en_US.UTF-8",
+		"DEBUG":  "1",
+	})
+	expect := []string{"DEBUG=1", "LC_ALL=en_US.UTF-8"}
+	if !reflect.DeepEqual(res, expect) {
+		t.Errorf("Environment variables are %v, want %v", res, expect)
+	}
+
+	_, err := newEntrypointOpt(&Script{
+		Run: []Step{
+			Step{Command: "cmd1", Env: map[string]string{"INVALID-NAME": "1"}},
+		},
+	}, &Config{}, nil)
+	if err == nil {
+		t.Error("An invalid environment variable name is accepted")
+	}
+
+}
+
+func TestNewEntrypointOptParallel(t *testing.T) {
+
+	opt, err := newEntrypointOpt(&Script{
+		Run: []Step{
+			Step{Command: "prepare"},
+			Step{
+				Parallel: []Step{
+					Step{Command: "cmd1"},
+					Step{Name: "second", Command: "cmd2"},
+				},
+				Concurrency: 2,
+			},
+			Step{Command: "merge"},
+		},
+	}, &Config{}, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(opt.Run) != 3 || len(opt.Run[1].Parallel) != 2 || opt.Run[1].Concurrency != 2 {
+		t.Fatalf("Steps are %+v", opt.Run)
+	}
+	var names []string
+	for _, step := range opt.Steps() {
+		names = append(names, step.Name)
+	}
+	if expect := []string{"step0", "step1", "second", "step3"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("Steps are %v, want %v", names, expect)
+	}
+	if stdout := opt.Run[1].Parallel[1].Logs.Stdout; stdout != LogDir+"/stdout2.txt" {
+		t.Errorf("Stdout of the second parallel step is %v", stdout)
+	}
+
+	_, err = newEntrypointOpt(&Script{
+		Run: []Step{
+			Step{
+				Parallel: []Step{
+					Step{Parallel: []Step{Step{Command: "cmd1"}}},
+				},
+			},
+		},
+	}, &Config{}, nil)
+	if err == nil {
+		t.Error("Nested parallel groups are accepted")
+	}
+
+}
+
+func TestBuiltinVariables(t *testing.T) {
+
+	s := &Script{
+		Name:  "task1",
+		Queue: "queue1",
+		Run: []Step{
+			Step{Command: "echo {{task}} {{attempt}} > {{instance}}.txt"},
+		},
+		Result: "gs://somebucket/{{queue}}/{{task}}/{{timestamp}}",
+		Upload: []string{"{{zone}}.log"},
+	}
+	start := time.Date(2017, 7, 1, 21, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+	vars := BuiltinVariables(s, &Config{Instance: "instance1", Zone: "us-central1-b"}, start, 2)
+
+	opt, err := newEntrypointOpt(s, &Config{}, vars)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cmd := opt.Run[0].Command; cmd != "echo task1 2 > instance1.txt" {
+		t.Errorf("Command is %v", cmd)
+	}
+	if opt.Result != "gs://somebucket/queue1/task1/20170701-120000/" {
+		t.Errorf("Result is %v", opt.Result)
+	}
+	if opt.Uploads[0] != "us-central1-b.log" {
+		t.Errorf("Uploads are %v", opt.Uploads)
+	}
+	if s.Result != "gs://somebucket/{{queue}}/{{task}}/{{timestamp}}" {
+		t.Errorf("Original script is modified: %v", s.Result)
 	}
 
 }
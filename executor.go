@@ -0,0 +1,158 @@
+//
+// executor.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/jkawamoto/roadie-azure/roadie"
+)
+
+const (
+	// ExecutorDocker is the executor using the Docker API.
+	ExecutorDocker = "docker"
+	// ExecutorPodman is the executor using the podman command.
+	ExecutorPodman = "podman"
+	// ExecutorProcess is the executor running entrypoints as host processes.
+	ExecutorProcess = "process"
+)
+
+// Executor builds images of scripts and runs sandbox containers.
+type Executor interface {
+	// HasImage returns true if an image of a given name exists.
+	HasImage(ctx context.Context, image string) (bool, error)
+	// Build builds an image from a Dockerfile.
+	Build(ctx context.Context, opt *BuildOpt) error
+	// Run runs a container and writes its stdout and stderr to given writers
+	// until it ends; it returns an error if the container exits with a
+	// non-zero status. The container is killed if the context is canceled.
+	Run(ctx context.Context, opt *ContainerOpt, stdout, stderr io.Writer) error
+}
+
+// BuildOpt defines options to build an image.
+type BuildOpt struct {
+	Image      string
+	Dockerfile []byte
+	// Logger receives messages while building.
+	Logger *log.Logger
+}
+
+// NewExecutor creates an executor of a given name.
+func NewExecutor(name string) (Executor, error) {
+
+	switch name {
+	case ExecutorDocker:
+		return &DockerExecutor{}, nil
+	case ExecutorPodman:
+		return &PodmanExecutor{Command: "podman"}, nil
+	case ExecutorProcess:
+		return &ProcessExecutor{}, nil
+	}
+	return nil, fmt.Errorf("unknown executor: %v", name)
+
+}
+
+// DockerExecutor is an executor using the Docker API.
+type DockerExecutor struct {
+	mutex sync.Mutex
+	// used has times images were used last in this process.
+	used map[string]time.Time
+}
+
+// HasImage returns true if an image of a given name exists.
+func (e *DockerExecutor) HasImage(ctx context.Context, image string) (exist bool, err error) {
+
+	docker, err := client.NewEnvClient()
+	if err != nil {
+		return
+	}
+	defer docker.Close()
+
+	images, err := docker.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return
+	}
+	for _, summary := range images {
+		for _, tag := range summary.RepoTags {
+			if tag == image {
+				return true, nil
+			}
+		}
+	}
+	return
+
+}
+
+// Build builds an image by roadie's Docker client.
+func (e *DockerExecutor) Build(ctx context.Context, opt *BuildOpt) (err error) {
+
+	cli, err := roadie.NewDockerClient(opt.Logger)
+	if err != nil {
+		return
+	}
+	defer cli.Close()
+
+	return cli.Build(ctx, &roadie.DockerBuildOpt{
+		ImageName:  opt.Image,
+		Dockerfile: opt.Dockerfile,
+	})
+
+}
+
+// Run runs a container via the Docker API.
+func (e *DockerExecutor) Run(ctx context.Context, opt *ContainerOpt, stdout, stderr io.Writer) (err error) {
+
+	e.mutex.Lock()
+	if e.used == nil {
+		e.used = make(map[string]time.Time)
+	}
+	e.used[opt.Image] = time.Now()
+	e.mutex.Unlock()
+
+	docker, err := client.NewEnvClient()
+	if err != nil {
+		return
+	}
+	defer docker.Close()
+	return RunContainer(ctx, docker, opt, stdout, stderr)
+
+}
+
+// lastUsed returns the time an image was used last; the given default time is
+// returned if it hasn't been used in this process.
+func (e *DockerExecutor) lastUsed(image string, def time.Time) time.Time {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if t, ok := e.used[image]; ok && t.After(def) {
+		return t
+	}
+	return def
+
+}
@@ -0,0 +1,310 @@
+//
+// executor_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+// fakeExecutor records built images and run containers instead of running
+// them; each run writes results of given steps to the status directory.
+type fakeExecutor struct {
+	images     map[string]bool
+	builds     []*BuildOpt
+	container  *ContainerOpt
+	entrypoint []byte
+	// statuses are exit statuses of steps written in results.
+	statuses map[string]int
+	output   string
+	err      error
+}
+
+func (e *fakeExecutor) HasImage(ctx context.Context, image string) (bool, error) {
+	return e.images[image], nil
+}
+
+func (e *fakeExecutor) Build(ctx context.Context, opt *BuildOpt) error {
+	if e.images == nil {
+		e.images = make(map[string]bool)
+	}
+	e.images[opt.Image] = true
+	e.builds = append(e.builds, opt)
+	return nil
+}
+
+func (e *fakeExecutor) Run(ctx context.Context, opt *ContainerOpt, stdout, stderr io.Writer) (err error) {
+
+	e.container = opt
+	for _, m := range opt.Mounts {
+		if m.Target == EntrypointPath {
+			if e.entrypoint, err = ioutil.ReadFile(m.Source); err != nil {
+				return
+			}
+		}
+		if m.Target != StatusPath {
+			continue
+		}
+		for name, status := range e.statuses {
+			err = WriteStepResult(filepath.Join(m.Source, name+".json"), &StepResult{
+				Name:       name,
+				ExitStatus: status,
+				StartedAt:  time.Now(),
+				FinishedAt: time.Now(),
+			})
+			if err != nil {
+				return
+			}
+		}
+	}
+	fmt.Fprint(stdout, e.output)
+	return e.err
+
+}
+
+func TestExecuteScript(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Script{
+		Name:  "train",
+		Image: "python:3",
+		Run: []Step{
+			Step{Name: "prepare", Command: "pip install -r requirements.txt"},
+			Step{Name: "train", Command: "python train.py"},
+		},
+		Env: map[string]string{
+			"PYTHONUNBUFFERED": "1",
+		},
+		Result: "gs://somebucket/{{task}}",
+	}
+	executor := &fakeExecutor{
+		statuses: map[string]int{"prepare": 0, "train": 0},
+		output:   "training\n",
+	}
+	buf := bytes.NewBuffer(nil)
+	cfg := &Config{
+		Executor: executor,
+		Results:  &FileResultStore{Dir: dir},
+	}
+
+	res, err := ExecuteScript(context.Background(), s, cfg, log.New(buf, "", 0))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.Status != TaskSucceeded || res.Result != "gs://somebucket/train/" || len(res.Steps) != 2 {
+		t.Errorf("Result is %+v", res)
+	}
+	if !strings.Contains(buf.String(), "training\n") {
+		t.Errorf("Outputs of the container aren't logged: %q", buf.String())
+	}
+
+	if len(executor.builds) != 1 {
+		t.Fatalf("%v images are built, want 1", len(executor.builds))
+	}
+	build := executor.builds[0]
+	if build.Image != ImageName(build.Dockerfile) || !bytes.Contains(build.Dockerfile, []byte("FROM python:3")) {
+		t.Errorf("Built image is %v from %s", build.Image, build.Dockerfile)
+	}
+	if !bytes.Contains(executor.entrypoint, []byte("python train.py")) {
+		t.Errorf("Entrypoint doesn't run steps: %s", executor.entrypoint)
+	}
+	if executor.container.Labels[LabelTask] != "train" {
+		t.Errorf("Container labels are %v", executor.container.Labels)
+	}
+	if executor.container.Image != build.Image {
+		t.Errorf("Container runs image %v, want %v", executor.container.Image, build.Image)
+	}
+	if expect := []string{"LC_ALL=C", "PYTHONUNBUFFERED=1"}; !reflect.DeepEqual(executor.container.Env, expect) {
+		t.Errorf("Environment variables are %v, want %v", executor.container.Env, expect)
+	}
+	helper, err := os.Executable()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if m := executor.container.Mounts[0]; m != bindMount(helper, HelperPath) {
+		t.Errorf("Helper isn't mounted: %+v", m)
+	}
+
+	// The stored result counts attempts.
+	executor.statuses["train"] = 1
+	executor.err = fmt.Errorf("container exited with status 1")
+	if res, err = ExecuteScript(context.Background(), s, cfg, log.New(ioutil.Discard, "", 0)); err == nil {
+		t.Error("Failed container doesn't return an error")
+	}
+	stored, err := cfg.Results.Get(context.Background(), "train")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if stored.Status != TaskFailed || stored.Attempt != 2 {
+		t.Errorf("Stored result is %+v", stored)
+	}
+	// The image is reused since the Dockerfile is the same.
+	if len(executor.builds) != 1 {
+		t.Errorf("%v images are built, want 1", len(executor.builds))
+	}
+
+}
+
+func TestExecuteScriptDeployKey(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{
+		DeployKey:  filepath.Join(dir, "deploy_key"),
+		KnownHosts: filepath.Join(dir, "known_hosts"),
+		Force:      true,
+	}
+	if err = ioutil.WriteFile(cfg.DeployKey, []byte("key"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = ioutil.WriteFile(cfg.KnownHosts, []byte("github.com ssh-ed25519 AAAA"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, c := range []struct {
+		source string
+		mount  bool
+	}{
+		{"git+ssh://git@github.com/jkawamoto/roadie-queue-manager.git", true},
+		{"https://example.com/source.tar.gz", false},
+	} {
+		executor := &fakeExecutor{}
+		cfg.Executor = executor
+		s := &Script{
+			Name:   "train",
+			Source: c.source,
+			Run: []Step{
+				Step{Command: "python train.py"},
+			},
+			Result: "gs://somebucket/{{task}}",
+		}
+		if _, err = ExecuteScript(context.Background(), s, cfg, log.New(ioutil.Discard, "", 0)); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		mounted := false
+		for _, m := range executor.container.Mounts {
+			if m.Source == cfg.DeployKey {
+				t.Errorf("Deploy key is mounted read-only: %+v", m)
+			}
+			if m.Target == SetupPath {
+				mounted = true
+				if m.ReadOnly {
+					t.Errorf("Setup directory isn't writable: %+v", m)
+				}
+			}
+		}
+		if mounted != c.mount {
+			t.Errorf("Deploy key is mounted = %v for source %v, want %v", mounted, c.source, c.mount)
+		}
+	}
+
+}
+
+func TestExecuteScriptCredentials(t *testing.T) {
+
+	executor := &fakeExecutor{
+		output: "cloned with secret-token\n",
+	}
+	cfg := &Config{
+		Executor: executor,
+		Credentials: CredentialStore{
+			"example.com": &Credential{Token: "secret-token"},
+		},
+		Force: true,
+	}
+	s := &Script{
+		Name:   "train",
+		Source: "https://example.com/source.tar.gz",
+		Run: []Step{
+			Step{Command: "python train.py"},
+		},
+		Result: "gs://somebucket/{{task}}",
+	}
+	buf := bytes.NewBuffer(nil)
+	if _, err := ExecuteScript(context.Background(), s, cfg, log.New(buf, "", 0)); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if strings.Contains(buf.String(), "secret-token") {
+		t.Errorf("Credential isn't masked in outputs: %q", buf.String())
+	}
+	if bytes.Contains(executor.entrypoint, []byte("secret-token")) {
+		t.Errorf("Entrypoint has the credential: %s", executor.entrypoint)
+	}
+	if !bytes.Contains(executor.entrypoint, []byte("-netrc "+ShellPath(CredentialsPath))) || !bytes.Contains(executor.entrypoint, []byte("-digest ")) {
+		t.Errorf("Entrypoint doesn't use the credential: %s", executor.entrypoint)
+	}
+	for _, m := range executor.container.Mounts {
+		if m.Target == SetupPath && m.ReadOnly {
+			t.Errorf("Setup directory isn't writable: %+v", m)
+		}
+	}
+
+}
+
+func TestPodmanRunArgs(t *testing.T) {
+
+	e := &PodmanExecutor{Command: "podman"}
+	args := e.runArgs(&ContainerOpt{
+		Image: "train",
+		Env:   []string{"LC_ALL=C"},
+		Labels: map[string]string{
+			LabelTask: "train",
+		},
+		Mounts: []mount.Mount{
+			bindMount("/usr/bin/roadie-queue-manager", HelperPath),
+			mount.Mount{Type: mount.TypeBind, Source: "/tmp/status", Target: StatusPath},
+		},
+	}, "roadie-1")
+	expect := []string{
+		"run", "--rm", "--name", "roadie-1", "--env", "LC_ALL=C", "--label", LabelTask + "=train",
+		"--mount", "type=bind,source=/usr/bin/roadie-queue-manager,target=" + HelperPath + ",readonly",
+		"--mount", "type=bind,source=/tmp/status,target=" + StatusPath,
+		"train",
+	}
+	if !reflect.DeepEqual(args, expect) {
+		t.Errorf("Arguments are %q, want %q", args, expect)
+	}
+
+}
@@ -0,0 +1,326 @@
+//
+// helper.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// This binary is mounted in sandbox containers at HelperPath, and
+// entrypoint.sh calls the following helper commands instead of shell utilities.
+
+// helpers maps helper command names to their implementations.
+var helpers = map[string]func(cli *CLI, args []string) int{
+	"credential": (*CLI).credential,
+	"download":   (*CLI).download,
+	"extract":    (*CLI).extract,
+	"mask":       (*CLI).mask,
+	"parallel":   (*CLI).parallel,
+	"run":        (*CLI).run,
+}
+
+// credential runs the credential helper command, which works as a git
+// credential helper giving credentials stored in a netrc file.
+func (cli *CLI) credential(args []string) int {
+	var netrc string
+
+	flags := flag.NewFlagSet("credential", flag.ContinueOnError)
+	flags.SetOutput(cli.errStream)
+	flags.StringVar(&netrc, "netrc", "", "netrc file which has credentials.")
+	if err := flags.Parse(args); err != nil {
+		return ExitCodeError
+	}
+	if netrc == "" || flags.NArg() != 1 {
+		fmt.Fprintln(cli.errStream, "Usage: roadie-queue-manager credential -netrc <file> <get|store|erase>")
+		return ExitCodeError
+	}
+
+	store, err := ReadNetrc(netrc)
+	if err != nil {
+		fmt.Fprintln(cli.errStream, "Cannot read credentials:", err.Error())
+		return ExitCodeError
+	}
+	if err = store.ServeGitCredential(flags.Arg(0), cli.inStream, cli.outStream); err != nil {
+		fmt.Fprintln(cli.errStream, err.Error())
+		return ExitCodeError
+	}
+	return ExitCodeOK
+}
+
+// download runs the download helper command which fetches a file and expands
+// it if an archive format is given.
+func (cli *CLI) download(args []string) int {
+	var (
+		format string
+		keep   bool
+		netrc  string
+	)
+
+	flags := flag.NewFlagSet("download", flag.ContinueOnError)
+	flags.SetOutput(cli.errStream)
+	flags.StringVar(&netrc, "netrc", "", "netrc file which has credentials.")
+	flags.StringVar(&format, "format", "", "Archive format of the downloaded file; it won't be expanded if omitted.")
+	flags.BoolVar(&keep, "keep", false, "Keep the archive file after it is expanded.")
+	if err := flags.Parse(args); err != nil {
+		return ExitCodeError
+	}
+	if flags.NArg() != 2 {
+		fmt.Fprintln(cli.errStream, "Usage: roadie-queue-manager download [-format <format>] [-keep] [-netrc <file>] <url> <file>")
+		return ExitCodeError
+	}
+	src, dest := flags.Arg(0), flags.Arg(1)
+
+	f := ArchiveNone
+	if format != "" {
+		var err error
+		if f, err = ParseArchiveFormat(format); err != nil {
+			fmt.Fprintln(cli.errStream, err.Error())
+			return ExitCodeError
+		}
+	}
+
+	var store CredentialStore
+	if netrc != "" {
+		var err error
+		if store, err = ReadNetrc(netrc); err != nil {
+			fmt.Fprintln(cli.errStream, "Cannot read credentials:", err.Error())
+			return ExitCodeError
+		}
+	}
+
+	fmt.Fprintln(cli.outStream, "Downloading", redactURL(src))
+	if err := Download(context.Background(), src, dest, store); err != nil {
+		fmt.Fprintln(cli.errStream, "Cannot download", redactURL(src), ":", err.Error())
+		return ExitCodeError
+	}
+
+	if f != ArchiveNone {
+		fmt.Fprintln(cli.outStream, "Expanding", dest)
+		if err := Extract(dest, f, keep); err != nil {
+			fmt.Fprintln(cli.errStream, "Cannot expand", dest, ":", err.Error())
+			return ExitCodeError
+		}
+	}
+	return ExitCodeOK
+}
+
+// extract runs the extract helper command which expands an archive file.
+func (cli *CLI) extract(args []string) int {
+	var (
+		format string
+		keep   bool
+	)
+
+	flags := flag.NewFlagSet("extract", flag.ContinueOnError)
+	flags.SetOutput(cli.errStream)
+	flags.StringVar(&format, "format", "", "Archive format; guessed from the file name if omitted.")
+	flags.BoolVar(&keep, "keep", false, "Keep the archive file after it is expanded.")
+	if err := flags.Parse(args); err != nil {
+		return ExitCodeError
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(cli.errStream, "Usage: roadie-queue-manager extract [-format <format>] [-keep] <file>")
+		return ExitCodeError
+	}
+	filename := flags.Arg(0)
+
+	f := ArchiveFormatOf(filename)
+	if format != "" {
+		var err error
+		if f, err = ParseArchiveFormat(format); err != nil {
+			fmt.Fprintln(cli.errStream, err.Error())
+			return ExitCodeError
+		}
+	}
+
+	fmt.Fprintln(cli.outStream, "Expanding", filename)
+	if err := Extract(filename, f, keep); err != nil {
+		fmt.Fprintln(cli.errStream, "Cannot expand", filename, ":", err.Error())
+		return ExitCodeError
+	}
+	return ExitCodeOK
+}
+
+// mask runs the mask helper command which replaces secrets in files of a
+// directory with SecretMask.
+func (cli *CLI) mask(args []string) int {
+	var files, digests listFlag
+	var salt string
+
+	flags := flag.NewFlagSet("mask", flag.ContinueOnError)
+	flags.SetOutput(cli.errStream)
+	flags.Var(&files, "secret", "File which has a secret; it can be given multiple times.")
+	flags.Var(&digests, "digest", "Digest of a secret made by DigestSecret; it can be given multiple times.")
+	flags.StringVar(&salt, "salt", "", "Salt of the digests in hex.")
+	if err := flags.Parse(args); err != nil {
+		return ExitCodeError
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(cli.errStream, "Usage: roadie-queue-manager mask [-secret <file>]... [-salt <hex> -digest <digest>...] <dir>")
+		return ExitCodeError
+	}
+	saltBytes, err := hex.DecodeString(salt)
+	if err != nil {
+		fmt.Fprintln(cli.errStream, "Invalid salt:", err.Error())
+		return ExitCodeError
+	}
+
+	var secrets [][]byte
+	for _, filename := range files {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(cli.errStream, "Cannot read a secret:", err.Error())
+			return ExitCodeError
+		}
+		secrets = append(secrets, data)
+	}
+	err = MaskFiles(flags.Arg(0), func(msg string) string {
+		return MaskDigests(MaskSecrets(msg, secrets), saltBytes, digests)
+	})
+	if err != nil {
+		fmt.Fprintln(cli.errStream, "Cannot mask secrets in logs:", err.Error())
+		return ExitCodeError
+	}
+	return ExitCodeOK
+}
+
+// run runs the run helper command which executes a run step and writes its
+// outputs to log files; it exits with the exit status of the step.
+func (cli *CLI) run(args []string) int {
+	var (
+		name    string
+		env     envFlag
+		workdir string
+		status  string
+		timeout time.Duration
+	)
+	logs := new(StepLogs)
+
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(cli.errStream)
+	flags.StringVar(&name, "name", "", "Name of the step which prefixes each line of outputs.")
+	flags.StringVar(&logs.Stdout, "stdout", "", "File stdout of the command is written to.")
+	flags.StringVar(&logs.Stderr, "stderr", "", "File stderr of the command is written to.")
+	flags.StringVar(&logs.Combined, "combined", "", "File both stdout and stderr of the command are written to.")
+	flags.Var(&env, "env", "Environment variable of the command given as KEY=VALUE; it can be given multiple times.")
+	flags.StringVar(&workdir, "workdir", "", "Working directory of the command.")
+	flags.DurationVar(&timeout, "timeout", 0, "Kill the command if it doesn't end within this duration.")
+	flags.StringVar(&status, "status", "", "File the result of the command is written to as JSON.")
+	if err := flags.Parse(args); err != nil {
+		return ExitCodeError
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(cli.errStream, "Usage: roadie-queue-manager run [-name <name>] [-stdout <file>] [-stderr <file>] [-combined <file>] [-env <key=value>]... [-workdir <dir>] [-timeout <duration>] [-status <file>] -- <command> [<args>...]")
+		return ExitCodeError
+	}
+
+	cmd := exec.Command(flags.Arg(0), flags.Args()[1:]...)
+	cmd.Stdin = cli.inStream
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Dir = workdir
+	var stdout, stderr io.Writer = cli.outStream, cli.errStream
+	if name != "" {
+		prefix := fmt.Sprintf("[%v] ", name)
+		stdout = &PrefixWriter{Prefix: prefix, Writer: stdout}
+		stderr = &PrefixWriter{Prefix: prefix, Writer: stderr}
+	}
+	res, err := RunStep(cmd, logs, timeout, stdout, stderr)
+	if err != nil {
+		fmt.Fprintln(cli.errStream, "Cannot run", flags.Arg(0), ":", err.Error())
+		return ExitCodeError
+	}
+	res.Name = name
+	if res.TimedOut {
+		fmt.Fprintln(stderr, "Killed because of the timeout", timeout)
+	}
+	if status != "" {
+		if err = WriteStepResult(status, res); err != nil {
+			fmt.Fprintln(cli.errStream, "Cannot write the result:", err.Error())
+		}
+	}
+	return res.ExitStatus
+}
+
+// parallel runs the parallel helper command which runs given command lines
+// concurrently; it exits with the first non-zero exit status of them.
+func (cli *CLI) parallel(args []string) int {
+	var concurrency int
+
+	flags := flag.NewFlagSet("parallel", flag.ContinueOnError)
+	flags.SetOutput(cli.errStream)
+	flags.IntVar(&concurrency, "concurrency", 0, "Max number of commands running at a time; 0 means no limits.")
+	if err := flags.Parse(args); err != nil {
+		return ExitCodeError
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(cli.errStream, "Usage: roadie-queue-manager parallel [-concurrency <n>] -- <command line>...")
+		return ExitCodeError
+	}
+
+	for _, status := range RunParallel(flags.Args(), concurrency, cli.outStream, cli.errStream) {
+		if status != 0 {
+			return status
+		}
+	}
+	return ExitCodeOK
+}
+
+// envFlag is a flag which can be given multiple times to set environment
+// variables.
+type envFlag []string
+
+// String returns the environment variables.
+func (f *envFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set adds an environment variable given as KEY=VALUE.
+func (f *envFlag) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("environment variable must be KEY=VALUE: %v", v)
+	}
+	*f = append(*f, v)
+	return nil
+}
+
+// listFlag is a flag which can be given multiple times.
+type listFlag []string
+
+// String returns the values.
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set adds a value.
+func (f *listFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
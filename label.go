@@ -0,0 +1,90 @@
+//
+// label.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LabelsAttribute defines a metadata attribute which has capability labels
+// of an instance given as a comma separated list.
+const LabelsAttribute = "roadie-labels"
+
+// Labels defines capability labels of an instance; a label given without a
+// value has the empty value.
+type Labels map[string]string
+
+// Set parses a comma separated list of labels given as <key> or
+// <key>=<value>, and adds them to the labels.
+func (l Labels) Set(spec string) error {
+
+	for _, v := range strings.Split(spec, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		kv := strings.SplitN(v, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if key == "" {
+			return fmt.Errorf("invalid label: %v", v)
+		}
+		l[key] = ""
+		if len(kv) == 2 {
+			l[key] = strings.TrimSpace(kv[1])
+		}
+	}
+	return nil
+
+}
+
+// Missing returns requirements the labels don't satisfy; a requirement
+// <key> is satisfied if there is a label of the key, and <key>=<value> is
+// satisfied if the label also has the value.
+func (l Labels) Missing(requires []string) (missing []string) {
+
+	for _, r := range requires {
+		kv := strings.SplitN(r, "=", 2)
+		value, ok := l[strings.TrimSpace(kv[0])]
+		if !ok || len(kv) == 2 && value != strings.TrimSpace(kv[1]) {
+			missing = append(missing, r)
+		}
+	}
+	return
+
+}
+
+// String returns the labels in the format Set accepts.
+func (l Labels) String() string {
+
+	items := make([]string, 0, len(l))
+	for k, v := range l {
+		if v != "" {
+			k += "=" + v
+		}
+		items = append(items, k)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+
+}
@@ -0,0 +1,60 @@
+//
+// label_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+
+	labels := make(Labels)
+	if err := labels.Set("gpu, machine=n1-highmem-8"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := labels.Set("zone=us-central1-a"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if res := labels.String(); res != "gpu,machine=n1-highmem-8,zone=us-central1-a" {
+		t.Errorf("Labels are %v", res)
+	}
+	if err := labels.Set("=value"); err == nil {
+		t.Error("A label without a key is parsed")
+	}
+
+	cases := []struct {
+		Requires []string
+		Expect   []string
+	}{
+		{nil, nil},
+		{[]string{"gpu", "machine=n1-highmem-8"}, nil},
+		{[]string{"gpu=true", "machine"}, []string{"gpu=true"}},
+		{[]string{"tpu", "zone=asia-east1-a"}, []string{"tpu", "zone=asia-east1-a"}},
+	}
+	for _, c := range cases {
+		if res := labels.Missing(c.Requires); !reflect.DeepEqual(res, c.Expect) {
+			t.Errorf("Missing requirements of %v are %v, want %v", c.Requires, res, c.Expect)
+		}
+	}
+
+}
@@ -0,0 +1,277 @@
+//
+// logsink.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// StreamStdout is the stream name of stdout of sandbox containers.
+	StreamStdout = "stdout"
+	// StreamStderr is the stream name of stderr of sandbox containers.
+	StreamStderr = "stderr"
+	// SyslogTag defines the tag of messages sent to syslog.
+	SyslogTag = "roadie"
+	// HTTPLogSinkQueueSize defines the number of entries an HTTP log sink
+	// holds while sending them.
+	HTTPLogSinkQueueSize = 1024
+	// HTTPLogSinkTimeout defines the timeout of each request of an HTTP log
+	// sink.
+	HTTPLogSinkTimeout = 10 * time.Second
+)
+
+// ErrLogSinkFull is returned when a log sink drops an entry because its queue
+// is full.
+var ErrLogSinkFull = errors.New("log sink queue is full")
+
+// ErrLogSinkClosed is returned when an entry is written to a closed log sink.
+var ErrLogSinkClosed = errors.New("log sink is closed")
+
+// LogEntry defines a line of outputs of a sandbox container.
+type LogEntry struct {
+	Time   time.Time `json:"time"`
+	Task   string    `json:"task"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"line"`
+}
+
+// String returns a tab separated representation of this entry.
+func (e *LogEntry) String() string {
+	return fmt.Sprintf("%v\t%v\t%v\t%v", e.Time.Format(time.RFC3339), e.Task, e.Stream, e.Line)
+}
+
+// LogSink receives outputs of sandbox containers while they are running.
+type LogSink interface {
+	// Write sends an entry to this sink.
+	Write(ctx context.Context, entry *LogEntry) error
+	// Close releases resources this sink uses.
+	Close() error
+}
+
+// NewLogSink creates a log sink from a specification; supported ones are
+//   - file:<path> appends entries to a file,
+//   - http://... and https://... post each entry as JSON to the URL in the
+//     background,
+//   - syslog: sends entries to the local syslog daemon, and
+//     syslog:<network>://<address> to a remote one, e.g. syslog:udp://host:514.
+func NewLogSink(spec string) (LogSink, error) {
+
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		return NewFileLogSink(strings.TrimPrefix(spec, "file:"))
+
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return NewHTTPLogSink(spec), nil
+
+	case strings.HasPrefix(spec, "syslog:"):
+		var network, addr string
+		if rest := strings.TrimPrefix(spec, "syslog:"); rest != "" {
+			u, err := url.Parse(rest)
+			if err != nil {
+				return nil, err
+			}
+			network, addr = u.Scheme, u.Host
+		}
+		w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_USER, SyslogTag)
+		if err != nil {
+			return nil, err
+		}
+		return &SyslogLogSink{writer: w}, nil
+
+	}
+	return nil, fmt.Errorf("unknown log sink: %v", spec)
+
+}
+
+// FileLogSink appends entries to a file.
+type FileLogSink struct {
+	mutex sync.Mutex
+	fp    io.WriteCloser
+}
+
+// NewFileLogSink opens a file and returns a log sink writing to it.
+func NewFileLogSink(filename string) (*FileLogSink, error) {
+	fp, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLogSink{fp: fp}, nil
+}
+
+// Write appends an entry as a line.
+func (s *FileLogSink) Write(ctx context.Context, entry *LogEntry) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = fmt.Fprintln(s.fp, entry.String())
+	return
+}
+
+// Close closes the file.
+func (s *FileLogSink) Close() error {
+	return s.fp.Close()
+}
+
+// HTTPLogSink posts entries to an HTTP endpoint asynchronously so that a slow
+// endpoint doesn't block sandbox containers; entries are dropped while the
+// queue is full.
+type HTTPLogSink struct {
+	URL    string
+	client *http.Client
+	queue  chan *LogEntry
+	done   chan struct{}
+	mutex  sync.Mutex
+	// err is the last error which hasn't been reported yet.
+	err error
+	// closed is true after the sink is closed; the queue mustn't be used.
+	closed bool
+}
+
+// NewHTTPLogSink creates a log sink posting entries to a given URL and starts
+// sending them.
+func NewHTTPLogSink(u string) *HTTPLogSink {
+
+	s := &HTTPLogSink{
+		URL: u,
+		client: &http.Client{
+			Timeout: HTTPLogSinkTimeout,
+		},
+		queue: make(chan *LogEntry, HTTPLogSinkQueueSize),
+		done:  make(chan struct{}),
+	}
+	go s.send()
+	return s
+
+}
+
+// Write queues an entry; it returns an error if the sink is closed, the queue
+// is full, or sending a previous entry failed.
+func (s *HTTPLogSink) Write(ctx context.Context, entry *LogEntry) (err error) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return ErrLogSinkClosed
+	}
+	if err, s.err = s.err, nil; err != nil {
+		return
+	}
+	select {
+	case s.queue <- entry:
+	default:
+		err = ErrLogSinkFull
+	}
+	return
+
+}
+
+// Close sends queued entries and returns the last error; closing the sink
+// again does nothing.
+func (s *HTTPLogSink) Close() error {
+
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mutex.Unlock()
+
+	<-s.done
+	return s.takeError()
+
+}
+
+// send posts queued entries until the queue is closed.
+func (s *HTTPLogSink) send() {
+
+	defer close(s.done)
+	for entry := range s.queue {
+		if err := s.post(entry); err != nil {
+			s.mutex.Lock()
+			s.err = err
+			s.mutex.Unlock()
+		}
+	}
+
+}
+
+// post posts an entry as a JSON object.
+func (s *HTTPLogSink) post(entry *LogEntry) (err error) {
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	res, err := s.client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("log sink returned %v", res.Status)
+	}
+	return
+
+}
+
+// takeError returns the last error and clears it.
+func (s *HTTPLogSink) takeError() (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err, s.err = s.err, nil
+	return
+}
+
+// SyslogLogSink sends entries to syslog; lines from stderr are sent with the
+// error priority.
+type SyslogLogSink struct {
+	writer *syslog.Writer
+}
+
+// Write sends an entry to syslog.
+func (s *SyslogLogSink) Write(ctx context.Context, entry *LogEntry) error {
+	msg := fmt.Sprintf("%v: %v", entry.Task, entry.Line)
+	if entry.Stream == StreamStderr {
+		return s.writer.Err(msg)
+	}
+	return s.writer.Info(msg)
+}
+
+// Close closes the connection to syslog.
+func (s *SyslogLogSink) Close() error {
+	return s.writer.Close()
+}
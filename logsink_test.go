@@ -0,0 +1,182 @@
+//
+// logsink_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileLogSink(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "tasks.log")
+	sink, err := NewLogSink("file:" + filename)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, line := range []string{"line1", "line2"} {
+		err = sink.Write(context.Background(), &LogEntry{
+			Time:   time.Date(2017, 7, 1, 12, 0, 0, 0, time.UTC),
+			Task:   "task1",
+			Stream: StreamStdout,
+			Line:   line,
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expect := "2017-07-01T12:00:00Z\ttask1\tstdout\tline1\n2017-07-01T12:00:00Z\ttask1\tstdout\tline2\n"
+	if string(data) != expect {
+		t.Errorf("Log file has %q, want %q", string(data), expect)
+	}
+
+}
+
+func TestHTTPLogSink(t *testing.T) {
+
+	var mutex sync.Mutex
+	var entries []LogEntry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var entry LogEntry
+		if err := json.NewDecoder(req.Body).Decode(&entry); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mutex.Lock()
+		entries = append(entries, entry)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	sink, err := NewLogSink(server.URL)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = sink.Write(context.Background(), &LogEntry{
+		Time:   time.Now(),
+		Task:   "task1",
+		Stream: StreamStderr,
+		Line:   "error message",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	mutex.Lock()
+	if len(entries) != 1 || entries[0].Task != "task1" || entries[0].Stream != StreamStderr || entries[0].Line != "error message" {
+		t.Errorf("Received entries are %+v", entries)
+	}
+	mutex.Unlock()
+
+	server.Config.Handler = http.NotFoundHandler()
+	sink = NewHTTPLogSink(server.URL)
+	if err = sink.Write(context.Background(), &LogEntry{}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = sink.Close(); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Error of a failed request is %v", err)
+	}
+
+}
+
+func TestHTTPLogSinkFull(t *testing.T) {
+
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+
+	sink := NewHTTPLogSink(server.URL)
+	for i := 0; i != HTTPLogSinkQueueSize+1; i++ {
+		sink.Write(context.Background(), &LogEntry{})
+	}
+	if err := sink.Write(context.Background(), &LogEntry{}); err != ErrLogSinkFull {
+		t.Errorf("Writing to a full sink returns %v, want %v", err, ErrLogSinkFull)
+	}
+	close(block)
+	sink.Close()
+
+}
+
+func TestHTTPLogSinkClosed(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	// Outputs of a container may still be written while the sink is closed.
+	sink := NewHTTPLogSink(server.URL)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if err := sink.Write(context.Background(), &LogEntry{}); err == ErrLogSinkClosed {
+				return
+			}
+		}
+	}()
+	if err := sink.Close(); err != nil {
+		t.Error(err.Error())
+	}
+	<-done
+
+	if err := sink.Write(context.Background(), &LogEntry{}); err != ErrLogSinkClosed {
+		t.Errorf("Writing to a closed sink returns %v, want %v", err, ErrLogSinkClosed)
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("Closing the sink again returns %v", err)
+	}
+
+}
+
+func TestNewLogSink(t *testing.T) {
+
+	if _, err := NewLogSink("kafka://localhost"); err == nil {
+		t.Error("Unknown log sink is created")
+	}
+
+}
@@ -24,6 +24,6 @@ package main
 import "os"
 
 func main() {
-	cli := &CLI{outStream: os.Stdout, errStream: os.Stderr}
+	cli := &CLI{inStream: os.Stdin, outStream: os.Stdout, errStream: os.Stderr}
 	os.Exit(cli.Run(os.Args))
 }
@@ -0,0 +1,209 @@
+//
+// matrix.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// MatrixLocal is the matrix mode which runs expanded scripts in this
+	// queue manager.
+	MatrixLocal = "local"
+	// MatrixEnqueue is the matrix mode which enqueues expanded scripts as
+	// child tasks.
+	MatrixEnqueue = "enqueue"
+)
+
+// ExpandMatrix expands a script having a matrix section into scripts for all
+// combinations of the parameters. Each expanded script is named after the
+// original one and its index, has the combination in Params, and
+// {{matrix.<name>}} in it is replaced with the parameter's value; follow-up
+// tasks are removed since they are enqueued once for the original script.
+func ExpandMatrix(s *Script) (scripts []*Script, err error) {
+
+	keys := make([]string, 0, len(s.Matrix))
+	for k, values := range s.Matrix {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("matrix parameter %v has no values", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	combinations := []map[string]string{{}}
+	for _, k := range keys {
+		var next []map[string]string
+		for _, c := range combinations {
+			for _, v := range s.Matrix[k] {
+				params := map[string]string{k: v}
+				for pk, pv := range c {
+					params[pk] = pv
+				}
+				next = append(next, params)
+			}
+		}
+		combinations = next
+	}
+
+	for i, params := range combinations {
+		vars := make(map[string]string, len(params))
+		for k, v := range params {
+			vars["matrix."+k] = v
+		}
+		child := Substitute(s, vars)
+		child.Name = fmt.Sprintf("%v-%v", s.Name, i)
+		child.Matrix = nil
+		child.Params = params
+		child.Next = nil
+		scripts = append(scripts, child)
+	}
+	return
+
+}
+
+// MatrixResult aggregates results of scripts expanded from a script having a
+// matrix section. The aggregated result succeeds only if all of them succeed,
+// otherwise it has the status and error of the first unsuccessful one, and its
+// result location is the common directory of theirs.
+func MatrixResult(s *Script, results []*TaskResult) *TaskResult {
+
+	res := &TaskResult{
+		Name:   s.Name,
+		Status: TaskSucceeded,
+	}
+	locations := make([]string, len(results))
+	for i, r := range results {
+		if i == 0 {
+			res.StartedAt = r.StartedAt
+		}
+		res.FinishedAt = r.FinishedAt
+		if r.Status != TaskSucceeded && res.Status == TaskSucceeded {
+			res.Status = r.Status
+			res.Error = r.Error
+		}
+		locations[i] = r.Result
+	}
+	res.Result = commonDir(locations)
+	return res
+
+}
+
+// commonDir returns the longest common prefix of locations ending with a
+// slash, or the location itself if all of them are the same.
+func commonDir(locations []string) string {
+
+	if len(locations) == 0 {
+		return ""
+	}
+	prefix := locations[0]
+	same := true
+	for _, l := range locations[1:] {
+		if l == prefix {
+			continue
+		}
+		same = false
+		i := 0
+		for i < len(prefix) && i < len(l) && prefix[i] == l[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	if same {
+		return prefix
+	}
+	return prefix[:strings.LastIndex(prefix, "/")+1]
+
+}
+
+// Substitute returns a copy of a script where {{<name>}} in source, data,
+// run steps, result, and upload sections is replaced with the value of the
+// variable.
+func Substitute(s *Script, vars map[string]string) *Script {
+
+	pairs := make([]string, 0, 2*len(vars))
+	for k, v := range vars {
+		pairs = append(pairs, "{{"+k+"}}", v)
+	}
+	r := strings.NewReplacer(pairs...)
+
+	res := *s
+	res.Source = r.Replace(s.Source)
+	res.Data = replaceAll(s.Data, r)
+	res.Env = substituteEnv(s.Env, r)
+	res.Run = substituteSteps(s.Run, r)
+	res.OnFailure = substituteSteps(s.OnFailure, r)
+	res.Finally = substituteSteps(s.Finally, r)
+	res.Result = r.Replace(s.Result)
+	res.Upload = replaceAll(s.Upload, r)
+	return &res
+
+}
+
+// replaceAll returns a copy of strings where variables are replaced.
+func replaceAll(strs []string, r *strings.Replacer) (res []string) {
+
+	if strs == nil {
+		return
+	}
+	res = make([]string, len(strs))
+	for i, str := range strs {
+		res[i] = r.Replace(str)
+	}
+	return
+
+}
+
+// substituteSteps returns copies of steps where variables are replaced.
+func substituteSteps(steps []Step, r *strings.Replacer) (res []Step) {
+
+	if steps == nil {
+		return
+	}
+	res = make([]Step, len(steps))
+	for i, step := range steps {
+		step.Command = r.Replace(step.Command)
+		step.Workdir = r.Replace(step.Workdir)
+		step.Env = substituteEnv(step.Env, r)
+		step.Parallel = substituteSteps(step.Parallel, r)
+		res[i] = step
+	}
+	return
+
+}
+
+// substituteEnv returns a copy of environment variables where variables in
+// their values are replaced.
+func substituteEnv(env map[string]string, r *strings.Replacer) (res map[string]string) {
+
+	if env == nil {
+		return
+	}
+	res = make(map[string]string, len(env))
+	for k, v := range env {
+		res[k] = r.Replace(v)
+	}
+	return
+
+}
@@ -0,0 +1,110 @@
+//
+// matrix_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandMatrix(t *testing.T) {
+
+	s := &Script{
+		Name: "train",
+		Matrix: map[string][]string{
+			"lr":    {"0.1", "0.01"},
+			"model": {"cnn", "rnn", "mlp"},
+		},
+		Env: map[string]string{
+			"MODEL": "{{matrix.model}}",
+		},
+		Run: []Step{
+			Step{Command: "python train.py --lr {{matrix.lr}} --model {{matrix.model}}"},
+			Step{Parallel: []Step{
+				Step{Command: "evaluate {{matrix.model}}", Workdir: "{{matrix.model}}"},
+			}},
+		},
+		Result: "gs://somebucket/{{matrix.model}}/{{matrix.lr}}",
+		Upload: []string{"{{matrix.model}}.h5"},
+	}
+	scripts, err := ExpandMatrix(s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(scripts) != 6 {
+		t.Fatalf("Matrix is expanded to %v scripts, want 6", len(scripts))
+	}
+
+	// Parameters are combined in the order of their names.
+	child := scripts[3]
+	if expect := map[string]string{"lr": "0.01", "model": "cnn"}; !reflect.DeepEqual(child.Params, expect) {
+		t.Errorf("Parameters are %v, want %v", child.Params, expect)
+	}
+	if child.Name != "train-3" || child.Matrix != nil {
+		t.Errorf("Expanded script is %+v", child)
+	}
+	if cmd := child.Run[0].Command; cmd != "python train.py --lr 0.01 --model cnn" {
+		t.Errorf("Command is %v", cmd)
+	}
+	if step := child.Run[1].Parallel[0]; step.Command != "evaluate cnn" || step.Workdir != "cnn" {
+		t.Errorf("Parallel step is %+v", step)
+	}
+	if child.Result != "gs://somebucket/cnn/0.01" || child.Upload[0] != "cnn.h5" || child.Env["MODEL"] != "cnn" {
+		t.Errorf("Expanded script is %+v", child)
+	}
+
+	// The original script must not be modified.
+	if s.Run[0].Command != "python train.py --lr {{matrix.lr}} --model {{matrix.model}}" || s.Env["MODEL"] != "{{matrix.model}}" {
+		t.Errorf("Original script is modified: %+v", s)
+	}
+
+	s.Matrix["seed"] = nil
+	if _, err = ExpandMatrix(s); err == nil {
+		t.Error("A parameter without values is accepted")
+	}
+
+}
+
+func TestMatrixResult(t *testing.T) {
+
+	s := &Script{
+		Name:   "train",
+		Result: "gs://somebucket/{{matrix.model}}/{{matrix.lr}}",
+	}
+	res := MatrixResult(s, []*TaskResult{
+		&TaskResult{Name: "train-0", Status: TaskSucceeded, Result: "gs://somebucket/cnn/0.1"},
+		&TaskResult{Name: "train-1", Status: TaskTimeout, Result: "gs://somebucket/cnn/0.01", Error: "timeout"},
+		&TaskResult{Name: "train-2", Status: TaskFailed, Result: "gs://somebucket/rnn/0.1"},
+	})
+	if res.Name != "train" || res.Status != TaskTimeout || res.Error != "timeout" || res.Result != "gs://somebucket/" {
+		t.Errorf("Aggregated result is %+v", res)
+	}
+
+	res = MatrixResult(s, []*TaskResult{
+		&TaskResult{Name: "train-0", Status: TaskSucceeded, Result: "gs://somebucket/model"},
+		&TaskResult{Name: "train-1", Status: TaskSucceeded, Result: "gs://somebucket/model"},
+	})
+	if res.Status != TaskSucceeded || res.Result != "gs://somebucket/model" {
+		t.Errorf("Aggregated result is %+v", res)
+	}
+
+}
@@ -23,6 +23,9 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -39,8 +42,18 @@ const (
 	HostnameMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/hostname"
 	// ZoneMetadataURL defines a metadata URL of the zone this instance running.
 	ZoneMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/zone"
+	// TokenMetadataURL defines a metadata URL of an access token of the default
+	// service account.
+	TokenMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	// InstanceAttributeMetadataURL defines a metadata URL of custom attributes of this instance.
+	InstanceAttributeMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/attributes/"
+	// ProjectAttributeMetadataURL defines a metadata URL of custom attributes of the project.
+	ProjectAttributeMetadataURL = "http://metadata.google.internal/computeMetadata/v1/project/attributes/"
 )
 
+// ErrMetadataNotFound is returned when a requested metadata entry doesn't exist.
+var ErrMetadataNotFound = errors.New("metadata not found")
+
 func getMetadata(ctx context.Context, url string) (str string, err error) {
 
 	req, err := http.NewRequest(http.MethodGet, url, nil)
@@ -54,6 +67,15 @@ func getMetadata(ctx context.Context, url string) (str string, err error) {
 	}
 	defer res.Body.Close()
 
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		err = ErrMetadataNotFound
+		return
+	case res.StatusCode != http.StatusOK:
+		err = fmt.Errorf("cannot retrieve metadata %v: %v", url, res.Status)
+		return
+	}
+
 	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return
@@ -86,3 +108,32 @@ func Zone(ctx context.Context) (zone string, err error) {
 	}
 	return
 }
+
+// Attribute returns a custom metadata attribute of a given key. Attributes of
+// this instance have priority over ones of the project. ErrMetadataNotFound
+// is returned if neither this instance nor the project has the attribute.
+func Attribute(ctx context.Context, key string) (value string, err error) {
+	value, err = getMetadata(ctx, InstanceAttributeMetadataURL+key)
+	if err == ErrMetadataNotFound {
+		value, err = getMetadata(ctx, ProjectAttributeMetadataURL+key)
+	}
+	return
+}
+
+// AccessToken returns an access token of the default service account of this
+// instance.
+func AccessToken(ctx context.Context) (token string, err error) {
+
+	str, err := getMetadata(ctx, TokenMetadataURL)
+	if err != nil {
+		return
+	}
+	var res struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.Unmarshal([]byte(str), &res); err != nil {
+		return
+	}
+	return res.AccessToken, nil
+
+}
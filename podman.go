@@ -0,0 +1,204 @@
+//
+// podman.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PodmanExecutor is an executor running the podman command, which has the
+// same interface as the docker command.
+type PodmanExecutor struct {
+	// Command is the name or the path of the podman command.
+	Command string
+}
+
+// HasImage returns true if an image of a given name exists.
+func (e *PodmanExecutor) HasImage(ctx context.Context, image string) (bool, error) {
+
+	err := exec.CommandContext(ctx, e.Command, "image", "exists", image).Run()
+	if err == nil {
+		return true, nil
+	} else if exitStatus(err) == 1 {
+		return false, nil
+	}
+	return false, err
+
+}
+
+// Build builds an image from a build context having only the Dockerfile.
+func (e *PodmanExecutor) Build(ctx context.Context, opt *BuildOpt) (err error) {
+
+	dir, err := ioutil.TempDir("", "roadie")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), opt.Dockerfile, 0644); err != nil {
+		return
+	}
+
+	output, err := exec.CommandContext(ctx, e.Command, "build", "-t", opt.Image, dir).CombinedOutput()
+	if opt.Logger != nil {
+		opt.Logger.Print(string(output))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot build image %v: %v", opt.Image, err)
+	}
+	return
+
+}
+
+// Run runs a container by podman run.
+func (e *PodmanExecutor) Run(ctx context.Context, opt *ContainerOpt, stdout, stderr io.Writer) (err error) {
+
+	name := opt.Name
+	if name == "" {
+		name = fmt.Sprintf("roadie-%v", time.Now().UnixNano())
+	}
+	cmd := exec.Command(e.Command, e.runArgs(opt, name)...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err = cmd.Start(); err != nil {
+		return
+	}
+
+	// Killing the podman command may leave the container running; the
+	// container is thereby killed by its name.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			exec.Command(e.Command, "kill", name).Run()
+		case <-done:
+		}
+	}()
+
+	if err = cmd.Wait(); err != nil {
+		return fmt.Errorf("container exited with status %v", exitStatus(err))
+	}
+	return
+
+}
+
+// RunningContainer returns a running container labelled with a given task.
+func (e *PodmanExecutor) RunningContainer(ctx context.Context, task string) (res *RunningContainer, err error) {
+
+	// Only running containers are listed by default.
+	output, err := exec.CommandContext(ctx, e.Command, "ps", "--filter", "label="+LabelTask+"="+task, "--format", "json").Output()
+	if err != nil {
+		return
+	}
+	var containers []struct {
+		ID     string            `json:"Id"`
+		Labels map[string]string `json:"Labels"`
+	}
+	if err = json.Unmarshal(output, &containers); err != nil {
+		return
+	}
+	for _, c := range containers {
+		if c.Labels[LabelTask] == task {
+			return &RunningContainer{
+				ID:     c.ID,
+				Labels: c.Labels,
+			}, nil
+		}
+	}
+	return
+
+}
+
+// Attach waits for a running container by podman logs and podman wait;
+// containers are removed when they exit since they run with --rm.
+func (e *PodmanExecutor) Attach(ctx context.Context, id string, keepFailed bool, stdout, stderr io.Writer) (err error) {
+
+	// podman wait starts first so that it receives the exit status before
+	// the container is removed.
+	status := bytes.NewBuffer(nil)
+	wait := exec.Command(e.Command, "wait", id)
+	wait.Stdout = status
+	if err = wait.Start(); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			exec.Command(e.Command, "kill", id).Run()
+		case <-done:
+		}
+	}()
+
+	logs := exec.Command(e.Command, "logs", "--follow", id)
+	logs.Stdout = stdout
+	logs.Stderr = stderr
+	logsErr := logs.Run()
+	if err = wait.Wait(); err != nil {
+		return
+	}
+	if code := strings.TrimSpace(status.String()); code != "0" {
+		return fmt.Errorf("container exited with status %v", code)
+	}
+	return logsErr
+
+}
+
+// runArgs returns arguments of podman run to run a container of a given name.
+func (e *PodmanExecutor) runArgs(opt *ContainerOpt, name string) []string {
+
+	args := []string{"run", "--rm", "--name", name}
+	for _, env := range opt.Env {
+		args = append(args, "--env", env)
+	}
+	keys := make([]string, 0, len(opt.Labels))
+	for k := range opt.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--label", k+"="+opt.Labels[k])
+	}
+	for _, m := range opt.Mounts {
+		v := []string{"type=" + string(m.Type), "source=" + m.Source, "target=" + m.Target}
+		if m.ReadOnly {
+			v = append(v, "readonly")
+		}
+		args = append(args, "--mount", strings.Join(v, ","))
+	}
+	return append(args, opt.Image)
+
+}
@@ -0,0 +1,211 @@
+//
+// process.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+const (
+	// ContainerWorkDir defines the working directory of sandbox containers.
+	ContainerWorkDir = "/data"
+	// containerTempDir defines the temporary directory of sandbox containers.
+	containerTempDir = "/tmp"
+	// containerHomeDir defines the home directory of sandbox containers.
+	containerHomeDir = "/root"
+)
+
+// ProcessExecutor is an executor running entrypoints directly as processes in
+// the host for trusted environments where containers aren't available.
+//
+// Each run has its own directory, which RootEnv is set to; it has the working
+// directory, the temporary directory, and the home directory, and mount
+// targets in it are linked to mount sources. Paths entrypoint.sh generates
+// are prefixed with RootEnv, but paths in commands of scripts are used as
+// they are. Commands run with a minimal environment, and images and apt
+// packages aren't used; commands must be installed in the host.
+type ProcessExecutor struct {
+	// Dir is the directory where per-task directories are created; the
+	// default temporary directory is used if empty.
+	Dir string
+}
+
+// HasImage always returns true since images aren't used.
+func (e *ProcessExecutor) HasImage(ctx context.Context, image string) (bool, error) {
+	return true, nil
+}
+
+// Build does nothing since images aren't used.
+func (e *ProcessExecutor) Build(ctx context.Context, opt *BuildOpt) error {
+	return nil
+}
+
+// Run runs the entrypoint mounted to EntrypointPath in a new directory, which
+// is removed after the run ends. Processes of the same task left by a
+// previous run, e.g. of a queue manager restarted while the task was running,
+// are killed first so that the task doesn't run twice.
+func (e *ProcessExecutor) Run(ctx context.Context, opt *ContainerOpt, stdout, stderr io.Writer) (err error) {
+
+	found := false
+	for _, m := range opt.Mounts {
+		if m.Target == EntrypointPath {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("entrypoint of %v isn't given", opt.Image)
+	}
+
+	base := e.Dir
+	if base == "" {
+		base = os.TempDir()
+	}
+	task := opt.Labels[LabelTask]
+	if task != "" {
+		if err = killLeftovers(base, task); err != nil {
+			return
+		}
+	}
+
+	dir, err := ioutil.TempDir(base, "roadie")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{ContainerWorkDir, containerTempDir, containerHomeDir} {
+		if err = os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			return
+		}
+	}
+	for _, m := range opt.Mounts {
+		if !filepath.IsAbs(m.Target) {
+			return fmt.Errorf("mount target %v isn't an absolute path", m.Target)
+		}
+		mapped := filepath.Join(dir, m.Target)
+		if err = os.MkdirAll(filepath.Dir(mapped), 0755); err != nil {
+			return
+		}
+		if err = os.Symlink(m.Source, mapped); err != nil {
+			return
+		}
+	}
+
+	// Environment variables of this queue manager, which may have secrets,
+	// aren't passed to the entrypoint.
+	cmd := exec.Command("bash", filepath.Join(dir, EntrypointPath))
+	cmd.Dir = filepath.Join(dir, ContainerWorkDir)
+	cmd.Env = append([]string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + filepath.Join(dir, containerHomeDir),
+		"TMPDIR=" + filepath.Join(dir, containerTempDir),
+		"LC_ALL=C.UTF-8",
+		RootEnv + "=" + dir,
+	}, opt.Env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// The entrypoint runs in a new process group so that all processes it
+	// starts are killed when the context is canceled.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = cmd.Start(); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+
+	// The task and the process group are recorded so that a restarted queue
+	// manager can kill them.
+	if task != "" {
+		if err = ioutil.WriteFile(filepath.Join(dir, "task"), []byte(task), 0644); err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, "pid"), []byte(strconv.Itoa(cmd.Process.Pid)), 0644)
+		}
+		if err != nil {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			cmd.Wait()
+			return
+		}
+	}
+
+	if err = cmd.Wait(); err != nil {
+		return fmt.Errorf("entrypoint exited with status %v", exitStatus(err))
+	}
+	return
+
+}
+
+// killLeftovers kills process groups of a given task recorded in per-task
+// directories in a given directory and removes the directories. A process is
+// killed only if it still runs the entrypoint in the directory so that
+// unrelated processes reusing the process ID aren't killed.
+func killLeftovers(base, task string) (err error) {
+
+	matches, err := filepath.Glob(filepath.Join(base, "roadie*", "task"))
+	if err != nil {
+		return
+	}
+	for _, filename := range matches {
+		if name, e := ioutil.ReadFile(filename); e != nil || string(name) != task {
+			continue
+		}
+		dir := filepath.Dir(filename)
+		if data, e := ioutil.ReadFile(filepath.Join(dir, "pid")); e == nil {
+			if pid, e := strconv.Atoi(string(data)); e == nil && runsEntrypoint(pid, dir) {
+				if err = syscall.Kill(-pid, syscall.SIGKILL); err != nil {
+					return
+				}
+			}
+		}
+		if err = os.RemoveAll(dir); err != nil {
+			return
+		}
+	}
+	return
+
+}
+
+// runsEntrypoint returns true if a given process runs the entrypoint in a
+// given per-task directory.
+func runsEntrypoint(pid int, dir string) bool {
+
+	cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/cmdline", pid))
+	if err != nil {
+		return false
+	}
+	return string(cmdline) == "bash\x00"+filepath.Join(dir, EntrypointPath)+"\x00"
+
+}
@@ -0,0 +1,243 @@
+//
+// process_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+func TestProcessExecutor(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	setup := filepath.Join(dir, "setup")
+	if err = os.Mkdir(setup, 0700); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = ioutil.WriteFile(filepath.Join(setup, "netrc"), []byte("machine github.com\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	status := filepath.Join(dir, "status")
+	if err = os.Mkdir(status, 0755); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	entrypoint := filepath.Join(dir, "entrypoint.sh")
+	if err = ioutil.WriteFile(entrypoint, []byte("cat \"$ROADIE_ROOT\"/roadie/setup/netrc\necho ok > \"$ROADIE_ROOT\"/roadie/status/step0.json\npwd\necho $GREETING $HOME\necho /data /tmpfiles\nexit $CODE\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	e := &ProcessExecutor{Dir: dir}
+	opt := &ContainerOpt{
+		Image: "task1",
+		Env:   []string{"GREETING=hello", "CODE=0"},
+		Mounts: []mount.Mount{
+			bindMount(entrypoint, EntrypointPath),
+			mount.Mount{Type: mount.TypeBind, Source: setup, Target: SetupPath},
+			mount.Mount{Type: mount.TypeBind, Source: status, Target: StatusPath},
+		},
+	}
+	stdout := bytes.NewBuffer(nil)
+	if err = e.Run(ctx, opt, stdout, ioutil.Discard); err != nil {
+		t.Fatal(err.Error())
+	}
+	lines := strings.Split(stdout.String(), "\n")
+	// Paths in commands aren't replaced.
+	if len(lines) != 5 || lines[0] != "machine github.com" || !strings.HasPrefix(lines[1], dir) || !strings.HasSuffix(lines[1], "/data") || !strings.HasPrefix(lines[2], "hello "+dir) || lines[3] != "/data /tmpfiles" {
+		t.Errorf("Outputs are %q", stdout.String())
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(status, "step0.json")); err != nil || string(data) != "ok\n" {
+		t.Errorf("Status file has %q: %v", data, err)
+	}
+	// The per-task directory is removed.
+	if matches, _ := filepath.Glob(filepath.Join(dir, "roadie*")); len(matches) != 0 {
+		t.Errorf("Directories %v remain", matches)
+	}
+
+	opt.Env = []string{"CODE=2"}
+	if err = e.Run(ctx, opt, ioutil.Discard, ioutil.Discard); err == nil {
+		t.Error("Failed entrypoint doesn't return an error")
+	}
+
+	// The entrypoint is killed when the context is canceled.
+	if err = ioutil.WriteFile(entrypoint, []byte("sleep 10 & wait\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err = e.Run(ctx, opt, ioutil.Discard, ioutil.Discard); err == nil {
+		t.Error("Killed entrypoint doesn't return an error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Entrypoint isn't killed")
+	}
+
+	if err = e.Run(ctx, &ContainerOpt{Image: "task3"}, ioutil.Discard, ioutil.Discard); err == nil {
+		t.Error("Container without an entrypoint runs")
+	}
+
+}
+
+func TestProcessExecutorMounts(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	secret := filepath.Join(dir, "secret")
+	if err = ioutil.WriteFile(secret, []byte("secret-token"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	// The program reads the secret file without the path in the entrypoint.
+	entrypoint := filepath.Join(dir, "entrypoint.sh")
+	if err = ioutil.WriteFile(entrypoint, []byte("cd ~ && cat .config/key.json\necho \"$MANAGER_SECRET\"\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	os.Setenv("MANAGER_SECRET", "manager-token")
+	defer os.Unsetenv("MANAGER_SECRET")
+
+	e := &ProcessExecutor{Dir: dir}
+	opt := &ContainerOpt{
+		Image: "task1",
+		Mounts: []mount.Mount{
+			bindMount(entrypoint, EntrypointPath),
+			bindMount(secret, "/root/.config/key.json"),
+		},
+	}
+	stdout := bytes.NewBuffer(nil)
+	if err = e.Run(context.Background(), opt, stdout, ioutil.Discard); err != nil {
+		t.Fatal(err.Error())
+	}
+	if stdout.String() != "secret-token\n" {
+		t.Errorf("Outputs are %q", stdout.String())
+	}
+
+	// Files mounted in other directories are placed in the directory given
+	// by RootEnv.
+	if err = ioutil.WriteFile(entrypoint, []byte("cat \"$ROADIE_ROOT\"/etc/key.json\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	opt.Mounts = append(opt.Mounts, bindMount(secret, "/etc/key.json"))
+	stdout.Reset()
+	if err = e.Run(context.Background(), opt, stdout, ioutil.Discard); err != nil {
+		t.Fatal(err.Error())
+	}
+	if stdout.String() != "secret-token" {
+		t.Errorf("Outputs are %q", stdout.String())
+	}
+
+	opt.Mounts = append(opt.Mounts, bindMount(secret, "key.json"))
+	if err = e.Run(context.Background(), opt, ioutil.Discard, ioutil.Discard); err == nil {
+		t.Error("Relative mount target is accepted")
+	}
+
+}
+
+func TestProcessExecutorLeftovers(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// A run of the task left by a previous queue manager.
+	leftover := filepath.Join(dir, "roadie-leftover")
+	if err = os.MkdirAll(filepath.Join(leftover, "roadie"), 0755); err != nil {
+		t.Fatal(err.Error())
+	}
+	script := filepath.Join(leftover, EntrypointPath)
+	if err = ioutil.WriteFile(script, []byte("sleep 10 & wait\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	cmd := exec.Command("bash", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err.Error())
+	}
+	defer syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	if err = ioutil.WriteFile(filepath.Join(leftover, "task"), []byte("train"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = ioutil.WriteFile(filepath.Join(leftover, "pid"), []byte(strconv.Itoa(cmd.Process.Pid)), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	entrypoint := filepath.Join(dir, "entrypoint.sh")
+	if err = ioutil.WriteFile(entrypoint, []byte("true\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	e := &ProcessExecutor{Dir: dir}
+	opt := &ContainerOpt{
+		Image:  "task1",
+		Mounts: []mount.Mount{bindMount(entrypoint, EntrypointPath)},
+		Labels: map[string]string{LabelTask: "evaluate"},
+	}
+	// Runs of other tasks don't kill the process.
+	if err = e.Run(context.Background(), opt, ioutil.Discard, ioutil.Discard); err != nil {
+		t.Fatal(err.Error())
+	}
+	select {
+	case <-exited:
+		t.Fatal("Process of another task is killed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	opt.Labels[LabelTask] = "train"
+	if err = e.Run(context.Background(), opt, ioutil.Discard, ioutil.Discard); err != nil {
+		t.Fatal(err.Error())
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Error("Leftover process isn't killed")
+	}
+	if _, err = os.Stat(leftover); !os.IsNotExist(err) {
+		t.Error("Leftover directory isn't removed")
+	}
+
+}
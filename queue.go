@@ -0,0 +1,373 @@
+//
+// queue.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/jkawamoto/roadie/cloud/gcp"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Task defines a task in a queue.
+type Task struct {
+	Name   string
+	Queue  string
+	Script *Script
+}
+
+// QueueBackend is a queue this queue manager fetches tasks from.
+type QueueBackend interface {
+	// Fetch returns a task having the highest priority in a given queue;
+	// tasks having the same priority are fetched in order. It returns nil if
+	// the queue has no tasks.
+	Fetch(ctx context.Context, queue string) (*Task, error)
+	// Enqueue adds a task to its queue; it returns ErrTaskExists if a task of
+	// the same name is in the queue even if it has been fetched.
+	Enqueue(ctx context.Context, task *Task) error
+	// Release puts a fetched task back to its queue so that it is fetched
+	// again after other tasks of the same priority.
+	Release(ctx context.Context, task *Task) error
+	// Renew extends the claim of a fetched task so that other instances don't
+	// fetch it while it is running.
+	Renew(ctx context.Context, task *Task) error
+	// Delete deletes a task from a queue.
+	Delete(ctx context.Context, queue, name string) error
+}
+
+const (
+	// QueueKind defines the kind of entities of tasks in Cloud Datastore.
+	QueueKind = "roadie-queue-manager-task"
+	// OccurrenceKind defines the kind of entities of the last enqueued
+	// occurrences of scheduled tasks in Cloud Datastore.
+	OccurrenceKind = "roadie-queue-manager-occurrence"
+	// ClaimTimeout defines how long a fetched task is claimed by an instance
+	// without renewing; other instances fetch it after the claim expires so
+	// that tasks of stopped instances run.
+	ClaimTimeout = 10 * time.Minute
+	// ClaimRenewInterval defines the interval of renewing claims of running
+	// tasks.
+	ClaimRenewInterval = ClaimTimeout / 4
+)
+
+var (
+	// ErrTaskExists is returned when a task of the same name is already in
+	// the queue.
+	ErrTaskExists = errors.New("task of the same name is already in the queue")
+	// ErrClaimLost is returned when a claim of a task cannot be renewed since
+	// the task has been deleted or fetched by another instance.
+	ErrClaimLost = errors.New("task is no longer claimed by this instance")
+)
+
+// GCPQueue is a queue backend storing tasks in Cloud Datastore. Each task is
+// an entity which has its queue, priority, the time it was enqueued, the
+// instance which fetched it and when the claim was renewed, and the whole
+// script in YAML so that no sections are lost.
+// Tasks added to roadie's queue, e.g. by roadie's command, are moved into the
+// backend when they are fetched; such tasks have only roadie's sections.
+type GCPQueue struct {
+	// service is roadie's queue tasks are moved from; nil disables moving.
+	service *gcp.QueueService
+	client  *DatastoreClient
+	// Worker is the name of this instance, which is recorded in fetched tasks
+	// so that other instances don't fetch them.
+	Worker string
+}
+
+// NewGCPQueue creates a queue backend for a project; the worker name is
+// recorded in tasks this instance fetches.
+func NewGCPQueue(ctx context.Context, project, worker string, logger *log.Logger) (q *GCPQueue, err error) {
+
+	service, err := gcp.NewQueueService(ctx, &gcp.Config{
+		Project: project,
+	}, logger)
+	if err != nil {
+		return
+	}
+	q = &GCPQueue{
+		service: service,
+		client:  NewDatastoreClient(project),
+		Worker:  worker,
+	}
+	return
+
+}
+
+// Fetch returns a task having the highest priority in a given queue which no
+// instances have claimed or whose claim has expired, the oldest one among
+// tasks having the same priority, and records this instance in it.
+func (q *GCPQueue) Fetch(ctx context.Context, queue string) (task *Task, err error) {
+
+	if err = q.moveTasks(ctx, queue); err != nil {
+		return
+	}
+	entities, err := q.client.Query(ctx, QueueKind, "Queue", StringValue(queue, false))
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	var candidates []*DatastoreEntity
+	for _, e := range entities {
+		if !claimed(e, now) {
+			candidates = append(candidates, e)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		pi, pj := candidates[i].Integer("Priority"), candidates[j].Integer("Priority")
+		if pi != pj {
+			return pi > pj
+		}
+		return candidates[i].Timestamp("CreatedAt").Before(candidates[j].Timestamp("CreatedAt"))
+	})
+
+	// Another instance may fetch the same task at the same time; the task is
+	// thereby claimed in a transaction and the next one is tried on conflicts.
+	for _, e := range candidates {
+		var fetched *DatastoreEntity
+		err = q.client.Update(ctx, e.Key, func(current *DatastoreEntity) *DatastoreEntity {
+			if current == nil || claimed(current, now) {
+				return nil
+			}
+			current.Properties["Worker"] = StringValue(q.Worker, false)
+			current.Properties["ClaimedAt"] = TimestampValue(now)
+			fetched = current
+			return current
+		})
+		if err == ErrDatastoreConflict {
+			continue
+		} else if err != nil {
+			return
+		} else if fetched == nil {
+			continue
+		}
+		return decodeTask(fetched)
+	}
+	return nil, nil
+
+}
+
+// Enqueue adds a task to its queue unless a task of the same name is in the
+// queue; the task is added in a transaction so that a task fetched at the
+// same time isn't replaced.
+func (q *GCPQueue) Enqueue(ctx context.Context, task *Task) (err error) {
+
+	data, err := yaml.Marshal(task.Script)
+	if err != nil {
+		return
+	}
+	key := q.client.Key(QueueKind, taskKey(task.Queue, task.Name))
+	exist := false
+	err = q.client.Update(ctx, key, func(current *DatastoreEntity) *DatastoreEntity {
+		if exist = current != nil; exist {
+			return nil
+		}
+		return &DatastoreEntity{
+			Key: key,
+			Properties: map[string]DatastoreValue{
+				"Queue":     StringValue(task.Queue, false),
+				"Name":      StringValue(task.Name, false),
+				"CreatedAt": TimestampValue(time.Now()),
+				"Priority":  IntegerValue(int64(task.Script.Priority)),
+				"Worker":    StringValue("", false),
+				"ClaimedAt": TimestampValue(time.Time{}),
+				"Script":    StringValue(string(data), true),
+			},
+		}
+	})
+	if err == nil && exist {
+		err = ErrTaskExists
+	}
+	return
+
+}
+
+// Release clears the claim of a task fetched by this instance and updates
+// the time it was enqueued.
+func (q *GCPQueue) Release(ctx context.Context, task *Task) error {
+	return q.updateClaim(ctx, task, func(e *DatastoreEntity) {
+		e.Properties["Worker"] = StringValue("", false)
+		e.Properties["ClaimedAt"] = TimestampValue(time.Time{})
+		e.Properties["CreatedAt"] = TimestampValue(time.Now())
+	})
+}
+
+// Renew updates the time a task fetched by this instance was claimed.
+func (q *GCPQueue) Renew(ctx context.Context, task *Task) error {
+	return q.updateClaim(ctx, task, func(e *DatastoreEntity) {
+		e.Properties["ClaimedAt"] = TimestampValue(time.Now())
+	})
+}
+
+// updateClaim updates a task in a transaction if this instance claims it;
+// otherwise ErrClaimLost is returned.
+func (q *GCPQueue) updateClaim(ctx context.Context, task *Task, update func(*DatastoreEntity)) (err error) {
+
+	lost := false
+	err = q.client.Update(ctx, q.client.Key(QueueKind, taskKey(task.Queue, task.Name)), func(current *DatastoreEntity) *DatastoreEntity {
+		if lost = current == nil || current.String("Worker") != q.Worker; lost {
+			return nil
+		}
+		update(current)
+		return current
+	})
+	if err == nil && lost {
+		err = ErrClaimLost
+	}
+	return
+
+}
+
+// RecordOccurrence records an occurrence of a scheduled task in an entity
+// named after the task unless the entity has the same or a later one.
+func (q *GCPQueue) RecordOccurrence(ctx context.Context, name string, scheduled time.Time) (recorded bool, err error) {
+
+	key := q.client.Key(OccurrenceKind, name)
+	err = q.client.Update(ctx, key, func(current *DatastoreEntity) *DatastoreEntity {
+		recorded = current == nil || current.Timestamp("Scheduled").Before(scheduled)
+		if !recorded {
+			return nil
+		}
+		return &DatastoreEntity{
+			Key: key,
+			Properties: map[string]DatastoreValue{
+				"Scheduled": TimestampValue(scheduled),
+			},
+		}
+	})
+	if err != nil {
+		recorded = false
+	}
+	return
+
+}
+
+// ForgetOccurrence removes an occurrence of a scheduled task if it is the
+// recorded one.
+func (q *GCPQueue) ForgetOccurrence(ctx context.Context, name string, scheduled time.Time) error {
+
+	key := q.client.Key(OccurrenceKind, name)
+	return q.client.Update(ctx, key, func(current *DatastoreEntity) *DatastoreEntity {
+		if current == nil || !current.Timestamp("Scheduled").Equal(scheduled) {
+			return nil
+		}
+		current.Properties["Scheduled"] = TimestampValue(time.Time{})
+		return current
+	})
+
+}
+
+// moveTasks moves tasks in roadie's queue into this backend; a task having the
+// name of a task in this backend is left in roadie's queue until the other
+// task is deleted.
+func (q *GCPQueue) moveTasks(ctx context.Context, queue string) (err error) {
+
+	if q.service == nil {
+		return
+	}
+	for {
+		var t *gcp.Task
+		t, err = q.service.Fetch(ctx, queue)
+		if err != nil || t == nil {
+			return
+		}
+		s := NewScript(t.Script)
+		s.Name = t.Name
+		s.Queue = queue
+		err = q.Enqueue(ctx, &Task{
+			Name:   t.Name,
+			Queue:  queue,
+			Script: s,
+		})
+		if err == ErrTaskExists {
+			return nil
+		} else if err != nil {
+			return
+		}
+		if err = q.service.DeleteTask(ctx, queue, t.Name); err != nil {
+			return
+		}
+	}
+
+}
+
+// claimed returns true if a task stored in an entity is claimed by an instance
+// and the claim hasn't expired at a given time.
+func claimed(e *DatastoreEntity, now time.Time) bool {
+	return e.String("Worker") != "" && now.Sub(e.Timestamp("ClaimedAt")) < ClaimTimeout
+}
+
+// KeepClaim renews the claim of a task periodically until the returned
+// function is called.
+func KeepClaim(ctx context.Context, backend QueueBackend, task *Task, logger *log.Logger) (stop func()) {
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-time.After(ClaimRenewInterval):
+			}
+			if err := backend.Renew(ctx, task); err != nil {
+				logger.Println("Cannot renew the claim of task", task.Name, ":", err.Error())
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+
+}
+
+// decodeTask returns a task stored in an entity.
+func decodeTask(e *DatastoreEntity) (task *Task, err error) {
+
+	s := new(Script)
+	if err = yaml.Unmarshal([]byte(e.String("Script")), s); err != nil {
+		return
+	}
+	s.Name = e.String("Name")
+	s.Queue = e.String("Queue")
+	task = &Task{
+		Name:   s.Name,
+		Queue:  s.Queue,
+		Script: s,
+	}
+	return
+
+}
+
+// taskKey returns the key name of a task in a queue.
+func taskKey(queue, name string) string {
+	return queue + "/" + name
+}
+
+// Delete deletes a task from a queue.
+func (q *GCPQueue) Delete(ctx context.Context, queue, name string) error {
+	return q.client.Delete(ctx, q.client.Key(QueueKind, taskKey(queue, name)))
+}
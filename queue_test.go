@@ -0,0 +1,367 @@
+//
+// queue_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDatastore is an in-memory Cloud Datastore serving the REST API methods
+// DatastoreClient uses.
+type fakeDatastore struct {
+	mutex    sync.Mutex
+	entities map[string]*DatastoreEntity
+}
+
+func (d *fakeDatastore) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.entities == nil {
+		d.entities = make(map[string]*DatastoreEntity)
+	}
+
+	var body struct {
+		Keys  []*DatastoreKey `json:"keys"`
+		Query struct {
+			Kind []struct {
+				Name string `json:"name"`
+			} `json:"kind"`
+			Filter struct {
+				PropertyFilter struct {
+					Property struct {
+						Name string `json:"name"`
+					} `json:"property"`
+					Value DatastoreValue `json:"value"`
+				} `json:"propertyFilter"`
+			} `json:"filter"`
+		} `json:"query"`
+		Mutations []struct {
+			Upsert *DatastoreEntity `json:"upsert"`
+			Delete *DatastoreKey    `json:"delete"`
+		} `json:"mutations"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var res interface{}
+	switch req.URL.Path[strings.LastIndex(req.URL.Path, ":")+1:] {
+	case "beginTransaction":
+		res = map[string]string{"transaction": "tx"}
+
+	case "lookup":
+		var found []map[string]*DatastoreEntity
+		for _, key := range body.Keys {
+			if e, ok := d.entities[fakeKey(key)]; ok {
+				found = append(found, map[string]*DatastoreEntity{"entity": e})
+			}
+		}
+		res = map[string]interface{}{"found": found}
+
+	case "runQuery":
+		filter := body.Query.Filter.PropertyFilter
+		var results []map[string]*DatastoreEntity
+		for _, e := range d.entities {
+			if e.Key.Path[0].Kind == body.Query.Kind[0].Name && e.String(filter.Property.Name) == *filter.Value.StringValue {
+				results = append(results, map[string]*DatastoreEntity{"entity": e})
+			}
+		}
+		res = map[string]interface{}{
+			"batch": map[string]interface{}{
+				"entityResults": results,
+				"moreResults":   "NO_MORE_RESULTS",
+			},
+		}
+
+	case "commit":
+		for _, m := range body.Mutations {
+			if m.Upsert != nil {
+				d.entities[fakeKey(m.Upsert.Key)] = m.Upsert
+			} else if m.Delete != nil {
+				delete(d.entities, fakeKey(m.Delete))
+			}
+		}
+		res = map[string]interface{}{}
+
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+
+}
+
+// fakeKey returns a string identifying a key.
+func fakeKey(key *DatastoreKey) string {
+	return key.Path[0].Kind + "/" + key.Path[0].Name
+}
+
+// newTestDatastoreClient creates a client of a fake datastore.
+func newTestDatastoreClient(server *httptest.Server) *DatastoreClient {
+	return &DatastoreClient{
+		Endpoint: server.URL + "/v1/projects/test",
+		Project:  "test",
+		Token: func(context.Context) (string, error) {
+			return "token", nil
+		},
+	}
+}
+
+// newTestGCPQueue creates a queue backend using a fake datastore.
+func newTestGCPQueue(server *httptest.Server, worker string) *GCPQueue {
+	return &GCPQueue{
+		client: newTestDatastoreClient(server),
+		Worker: worker,
+	}
+}
+
+func TestGCPQueue(t *testing.T) {
+
+	server := httptest.NewServer(new(fakeDatastore))
+	defer server.Close()
+	queue := newTestGCPQueue(server, "instance-1")
+	other := newTestGCPQueue(server, "instance-2")
+
+	notBefore := time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := time.Date(2017, 7, 2, 0, 0, 0, 0, time.UTC)
+	s := &Script{
+		Name:   "train",
+		Queue:  "default",
+		Image:  "python:3",
+		APT:    []string{"git"},
+		Source: "https://github.com/jkawamoto/roadie.git@develop",
+		Data:   []string{"gs://somebucket/data.csv"},
+		Run: []Step{
+			Step{Command: "pip install -r requirements.txt"},
+			Step{Name: "train", Command: "python train.py", Timeout: time.Hour, Env: map[string]string{"DEBUG": "1"}, Workdir: "src"},
+			Step{Concurrency: 2, Parallel: []Step{Step{Command: "cmd1"}, Step{Command: "cmd2"}}},
+		},
+		Result:          "gs://somebucket/{{task}}",
+		Upload:          []string{"*.csv"},
+		OnFailure:       []Step{Step{Command: "tar czf dump.tar.gz checkpoints"}},
+		Finally:         []Step{Step{Command: "rm -rf /tmp/cache"}},
+		StopOnFailure:   true,
+		UploadOnFailure: true,
+		Matrix:          map[string][]string{"lr": []string{"0.1", "0.01"}},
+		Params:          map[string]string{"model": "cnn"},
+		Parent: &Parent{
+			Name: "search",
+			Next: &Next{OnSuccess: []FollowUp{FollowUp{Script: &Script{Run: []Step{Step{Command: "python report.py"}}}}}},
+		},
+		Env:       map[string]string{"PYTHONUNBUFFERED": "1"},
+		Timeout:   6 * time.Hour,
+		Logs:      LogNames{Stdout: "{{step}}.out", Stderr: "{{step}}.err", Combined: LogNameNone},
+		Priority:  3,
+		NotBefore: &notBefore,
+		ExpiresAt: &expiresAt,
+		Requires:  []string{"gpu", "machine=n1-highmem-8"},
+		DependsOn: []string{"preprocess"},
+		Next: &Next{
+			OnSuccess: []FollowUp{
+				FollowUp{Name: "evaluate", Queue: "evaluation", Script: &Script{Run: []Step{Step{Command: "python evaluate.py"}}}},
+			},
+			OnFailure: []FollowUp{
+				FollowUp{Script: &Script{Run: []Step{Step{Command: "notify"}}}},
+			},
+		},
+		Secrets: []SecretOpt{
+			SecretOpt{Name: "api-key", Env: "TOKEN"},
+			SecretOpt{Name: "service-account", File: "/root/key.json"},
+		},
+		Cache: true,
+	}
+	// Every section must be set so that the test covers sections added later.
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if reflect.DeepEqual(v.Field(i).Interface(), reflect.Zero(v.Field(i).Type()).Interface()) {
+			t.Fatalf("Section %v isn't set in the test script", v.Type().Field(i).Name)
+		}
+	}
+
+	ctx := context.Background()
+	if err := queue.Enqueue(ctx, &Task{Name: s.Name, Queue: s.Queue, Script: s}); err != nil {
+		t.Fatal(err.Error())
+	}
+	task, err := queue.Fetch(ctx, "default")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if task == nil {
+		t.Fatal("No tasks are fetched")
+	}
+	if task.Name != "train" || task.Queue != "default" {
+		t.Errorf("Fetched task is %v in %v", task.Name, task.Queue)
+	}
+	if !reflect.DeepEqual(task.Script, s) {
+		t.Errorf("Fetched script is %+v, want %+v", task.Script, s)
+	}
+
+	// A fetched task isn't fetched by other instances.
+	if task, err = other.Fetch(ctx, "default"); err != nil {
+		t.Fatal(err.Error())
+	} else if task != nil {
+		t.Errorf("Task %v is fetched twice", task.Name)
+	}
+	if task, err = queue.Fetch(ctx, "other"); err != nil {
+		t.Fatal(err.Error())
+	} else if task != nil {
+		t.Errorf("Task %v is fetched from another queue", task.Name)
+	}
+
+	if err = queue.Delete(ctx, "default", "train"); err != nil {
+		t.Fatal(err.Error())
+	}
+	// A deleted task can be enqueued again.
+	if err = queue.Enqueue(ctx, &Task{Name: s.Name, Queue: s.Queue, Script: s}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if task, err = other.Fetch(ctx, "default"); err != nil {
+		t.Fatal(err.Error())
+	} else if task == nil || task.Name != "train" {
+		t.Errorf("Re-enqueued task isn't fetched: %+v", task)
+	}
+
+}
+
+func TestGCPQueueClaim(t *testing.T) {
+
+	store := new(fakeDatastore)
+	server := httptest.NewServer(store)
+	defer server.Close()
+	queue := newTestGCPQueue(server, "instance-1")
+	other := newTestGCPQueue(server, "instance-2")
+
+	ctx := context.Background()
+	task := &Task{Name: "train", Queue: "default", Script: &Script{Name: "train"}}
+	if err := queue.Enqueue(ctx, task); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fetched, err := queue.Fetch(ctx, "default"); err != nil || fetched == nil {
+		t.Fatalf("Task isn't fetched: %v", err)
+	}
+
+	// Enqueuing a task of the same name doesn't clear the claim.
+	if err := other.Enqueue(ctx, task); err != ErrTaskExists {
+		t.Errorf("Enqueuing an existing task returns %v, want %v", err, ErrTaskExists)
+	}
+	if fetched, err := other.Fetch(ctx, "default"); err != nil || fetched != nil {
+		t.Errorf("Claimed task is fetched again: %+v (%v)", fetched, err)
+	}
+	if err := other.Renew(ctx, task); err != ErrClaimLost {
+		t.Errorf("Other instance renews the claim: %v", err)
+	}
+	if err := queue.Renew(ctx, task); err != nil {
+		t.Errorf("Claim isn't renewed: %v", err)
+	}
+
+	// An expired claim is taken over by another instance.
+	store.mutex.Lock()
+	store.entities[QueueKind+"/default/train"].Properties["ClaimedAt"] = TimestampValue(time.Now().Add(-ClaimTimeout))
+	store.mutex.Unlock()
+	if fetched, err := other.Fetch(ctx, "default"); err != nil || fetched == nil || fetched.Name != "train" {
+		t.Fatalf("Task having an expired claim isn't fetched: %+v (%v)", fetched, err)
+	}
+	if err := queue.Renew(ctx, task); err != ErrClaimLost {
+		t.Errorf("Expired claim is renewed: %v", err)
+	}
+
+	// A released task is fetched again.
+	if err := queue.Release(ctx, task); err != ErrClaimLost {
+		t.Errorf("Task claimed by another instance is released: %v", err)
+	}
+	if err := other.Release(ctx, task); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fetched, err := queue.Fetch(ctx, "default"); err != nil || fetched == nil || fetched.Name != "train" {
+		t.Errorf("Released task isn't fetched: %+v (%v)", fetched, err)
+	}
+
+}
+
+func TestGCPQueuePriority(t *testing.T) {
+
+	server := httptest.NewServer(new(fakeDatastore))
+	defer server.Close()
+	queue := newTestGCPQueue(server, "instance-1")
+
+	ctx := context.Background()
+	for _, task := range []*Task{
+		&Task{Name: "low", Queue: "default", Script: &Script{Priority: -1}},
+		&Task{Name: "first", Queue: "default", Script: &Script{}},
+		&Task{Name: "high", Queue: "default", Script: &Script{Priority: 5}},
+		&Task{Name: "second", Queue: "default", Script: &Script{}},
+	} {
+		if err := queue.Enqueue(ctx, task); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	for _, expect := range []string{"high", "first", "second", "low"} {
+		task, err := queue.Fetch(ctx, "default")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if task == nil || task.Name != expect {
+			t.Fatalf("Fetched task is %+v, want %v", task, expect)
+		}
+	}
+
+}
+
+func TestGCPQueueOccurrence(t *testing.T) {
+
+	server := httptest.NewServer(new(fakeDatastore))
+	defer server.Close()
+	queue := newTestGCPQueue(server, "instance-1")
+	other := newTestGCPQueue(server, "instance-2")
+
+	ctx := context.Background()
+	scheduled := time.Date(2017, 7, 5, 3, 0, 0, 0, time.UTC)
+	if recorded, err := queue.RecordOccurrence(ctx, "nightly", scheduled); err != nil || !recorded {
+		t.Fatalf("Occurrence isn't recorded: %v", err)
+	}
+	// Other instances don't record the same or earlier occurrences.
+	for _, s := range []time.Time{scheduled, scheduled.Add(-24 * time.Hour)} {
+		if recorded, err := other.RecordOccurrence(ctx, "nightly", s); err != nil || recorded {
+			t.Errorf("Occurrence at %v is recorded twice: %v", s, err)
+		}
+	}
+
+	// A forgotten occurrence is recorded again.
+	if err := queue.ForgetOccurrence(ctx, "nightly", scheduled); err != nil {
+		t.Fatal(err.Error())
+	}
+	if recorded, err := other.RecordOccurrence(ctx, "nightly", scheduled); err != nil || !recorded {
+		t.Errorf("Forgotten occurrence isn't recorded: %v", err)
+	}
+
+}
@@ -0,0 +1,263 @@
+//
+// result.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// ResultKind defines the kind of entities of results in Cloud Datastore.
+	ResultKind = "roadie-queue-manager-result"
+	// CacheKind defines the kind of entities of cached results in Cloud
+	// Datastore.
+	CacheKind = "roadie-queue-manager-cache"
+	// ResultDir is the default directory results of tasks are stored.
+	ResultDir = "/root/results"
+	// TaskSucceeded is the status of tasks of which all steps succeeded.
+	TaskSucceeded = "succeeded"
+	// TaskFailed is the status of tasks which couldn't run or had failed steps.
+	TaskFailed = "failed"
+	// TaskTimeout is the status of tasks killed by timeouts.
+	TaskTimeout = "timeout"
+	// TaskExpired is the status of tasks dropped since they expired.
+	TaskExpired = "expired"
+	// TaskEnqueued is the status of matrix tasks whose expanded scripts are
+	// enqueued as child tasks; results of the children decide whether the
+	// task succeeded.
+	TaskEnqueued = "enqueued"
+)
+
+// TaskResult defines a result of a task.
+type TaskResult struct {
+	Name    string            `json:"name"`
+	Params  map[string]string `json:"params,omitempty"`
+	Status  string            `json:"status"`
+	Attempt int               `json:"attempt"`
+	// Result is the location results of the task are uploaded.
+	Result string `json:"result,omitempty"`
+	// CacheKey is the content hash of the script.
+	CacheKey string `json:"cache_key,omitempty"`
+	// CachedFrom is the name of the task whose results are reused if the
+	// task was skipped by a cache hit.
+	CachedFrom string `json:"cached_from,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Children are names of child tasks enqueued by a matrix task.
+	Children   []string     `json:"children,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	Steps      []StepResult `json:"steps,omitempty"`
+}
+
+// StepResult defines a result of a run step.
+type StepResult struct {
+	Name       string    `json:"name"`
+	ExitStatus int       `json:"exit_status"`
+	TimedOut   bool      `json:"timed_out,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// ReadStepResult reads a step result written by the run helper command.
+func ReadStepResult(filename string) (res *StepResult, err error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	res = new(StepResult)
+	err = json.Unmarshal(data, res)
+	return
+
+}
+
+// WriteStepResult writes a step result to a file.
+func WriteStepResult(filename string, res *StepResult) (err error) {
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+
+}
+
+// ResultStore stores results of tasks.
+type ResultStore interface {
+	// Put stores a result.
+	Put(ctx context.Context, res *TaskResult) error
+	// Get returns the result of a given task; it returns nil if not found.
+	Get(ctx context.Context, name string) (*TaskResult, error)
+	// Cached returns the last succeeded result having a given cache key; it
+	// returns nil if not found.
+	Cached(ctx context.Context, key string) (*TaskResult, error)
+}
+
+// NewResultStore creates a result store from a specification; file:<dir>
+// stores results as JSON files in the directory, and datastore:[<project>]
+// stores them in Cloud Datastore of the project, or of a given default one,
+// so that instances share them.
+func NewResultStore(spec, project string) (ResultStore, error) {
+
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		return &FileResultStore{Dir: strings.TrimPrefix(spec, "file:")}, nil
+
+	case strings.HasPrefix(spec, "datastore:"):
+		if p := strings.TrimPrefix(spec, "datastore:"); p != "" {
+			project = p
+		}
+		return &DatastoreResultStore{client: NewDatastoreClient(project)}, nil
+
+	}
+	return nil, fmt.Errorf("unknown result store: %v", spec)
+
+}
+
+// FileResultStore stores results as JSON files named after tasks.
+type FileResultStore struct {
+	Dir string
+}
+
+// Put writes a result to a file.
+func (s *FileResultStore) Put(ctx context.Context, res *TaskResult) (err error) {
+
+	if err = os.MkdirAll(s.Dir, 0755); err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(s.filename(res.Name), data, 0644); err != nil {
+		return
+	}
+
+	// Succeeded results are also stored in the cache directory.
+	if res.Status != TaskSucceeded || res.CacheKey == "" {
+		return
+	}
+	if err = os.MkdirAll(filepath.Join(s.Dir, "cache"), 0755); err != nil {
+		return
+	}
+	return ioutil.WriteFile(s.cacheFilename(res.CacheKey), data, 0644)
+
+}
+
+// Get reads the result of a given task.
+func (s *FileResultStore) Get(ctx context.Context, name string) (*TaskResult, error) {
+	return readTaskResult(s.filename(name))
+}
+
+// Cached reads the last succeeded result having a given cache key.
+func (s *FileResultStore) Cached(ctx context.Context, key string) (*TaskResult, error) {
+	return readTaskResult(s.cacheFilename(key))
+}
+
+// filename returns the path to the result file of a task.
+func (s *FileResultStore) filename(name string) string {
+	return filepath.Join(s.Dir, filepath.Base(name)+".json")
+}
+
+// cacheFilename returns the path to the result file of a cache key.
+func (s *FileResultStore) cacheFilename(key string) string {
+	return filepath.Join(s.Dir, "cache", filepath.Base(key)+".json")
+}
+
+// DatastoreResultStore stores results as JSON in entities of Cloud Datastore
+// named after tasks; succeeded results are also stored in entities named after
+// their cache keys.
+type DatastoreResultStore struct {
+	client *DatastoreClient
+}
+
+// Put writes a result to an entity.
+func (s *DatastoreResultStore) Put(ctx context.Context, res *TaskResult) (err error) {
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return
+	}
+	err = s.client.Upsert(ctx, &DatastoreEntity{
+		Key: s.client.Key(ResultKind, res.Name),
+		Properties: map[string]DatastoreValue{
+			"Result": StringValue(string(data), true),
+		},
+	})
+	if err != nil || res.Status != TaskSucceeded || res.CacheKey == "" {
+		return
+	}
+	return s.client.Upsert(ctx, &DatastoreEntity{
+		Key: s.client.Key(CacheKind, res.CacheKey),
+		Properties: map[string]DatastoreValue{
+			"Result": StringValue(string(data), true),
+		},
+	})
+
+}
+
+// Get reads the result of a given task.
+func (s *DatastoreResultStore) Get(ctx context.Context, name string) (*TaskResult, error) {
+	return s.get(ctx, s.client.Key(ResultKind, name))
+}
+
+// Cached reads the last succeeded result having a given cache key.
+func (s *DatastoreResultStore) Cached(ctx context.Context, key string) (*TaskResult, error) {
+	return s.get(ctx, s.client.Key(CacheKind, key))
+}
+
+// get reads a result stored in an entity of a given key; it returns nil if the
+// entity doesn't exist.
+func (s *DatastoreResultStore) get(ctx context.Context, key *DatastoreKey) (res *TaskResult, err error) {
+
+	entity, err := s.client.Lookup(ctx, key)
+	if err != nil || entity == nil {
+		return
+	}
+	res = new(TaskResult)
+	err = json.Unmarshal([]byte(entity.String("Result")), res)
+	return
+
+}
+
+// readTaskResult reads a result file; it returns nil if the file doesn't
+// exist.
+func readTaskResult(filename string) (res *TaskResult, err error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	res = new(TaskResult)
+	err = json.Unmarshal(data, res)
+	return
+
+}
@@ -0,0 +1,147 @@
+//
+// result_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileResultStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewResultStore("file:"+dir, "test")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ctx := context.Background()
+	if res, err := store.Get(ctx, "task1"); err != nil || res != nil {
+		t.Errorf("Result of a task which hasn't run is %v (%v)", res, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	res := &TaskResult{
+		Name:       "task1",
+		Status:     TaskTimeout,
+		StartedAt:  now,
+		FinishedAt: now.Add(time.Hour),
+		Steps: []StepResult{
+			StepResult{Name: "step0", ExitStatus: TimeoutExitStatus, TimedOut: true},
+		},
+	}
+	if err = store.Put(ctx, res); err != nil {
+		t.Fatal(err.Error())
+	}
+	stored, err := store.Get(ctx, "task1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(stored, res) {
+		t.Errorf("Stored result is %+v, want %+v", stored, res)
+	}
+
+	if _, err = NewResultStore("mysql://localhost", "test"); err == nil {
+		t.Error("Unknown result store is created")
+	}
+
+}
+
+func TestDatastoreResultStore(t *testing.T) {
+
+	server := httptest.NewServer(new(fakeDatastore))
+	defer server.Close()
+	store := &DatastoreResultStore{client: newTestDatastoreClient(server)}
+
+	ctx := context.Background()
+	if res, err := store.Get(ctx, "task1"); err != nil || res != nil {
+		t.Errorf("Result of a task which hasn't run is %v (%v)", res, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	res := &TaskResult{
+		Name:       "task1",
+		Status:     TaskSucceeded,
+		CacheKey:   "abc",
+		StartedAt:  now,
+		FinishedAt: now.Add(time.Hour),
+	}
+	if err := store.Put(ctx, res); err != nil {
+		t.Fatal(err.Error())
+	}
+	stored, err := store.Get(ctx, "task1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(stored, res) {
+		t.Errorf("Stored result is %+v, want %+v", stored, res)
+	}
+	cached, err := store.Cached(ctx, "abc")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(cached, res) {
+		t.Errorf("Cached result is %+v, want %+v", cached, res)
+	}
+
+	spec, err := NewResultStore("datastore:", "project1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if c := spec.(*DatastoreResultStore).client; c.Project != "project1" {
+		t.Errorf("Project of the result store is %v, want project1", c.Project)
+	}
+
+}
+
+func TestTaskStatus(t *testing.T) {
+
+	cases := []struct {
+		Steps  []StepResult
+		Error  bool
+		Expect string
+	}{
+		{[]StepResult{{ExitStatus: 0}, {ExitStatus: 0}}, false, TaskSucceeded},
+		{[]StepResult{{ExitStatus: 1}, {ExitStatus: 0}}, false, TaskFailed},
+		{[]StepResult{{ExitStatus: 1}, {ExitStatus: TimeoutExitStatus, TimedOut: true}}, true, TaskTimeout},
+		{nil, true, TaskFailed},
+	}
+	for _, c := range cases {
+		var err error
+		if c.Error {
+			err = os.ErrNotExist
+		}
+		if res := taskStatus(c.Steps, err); res != c.Expect {
+			t.Errorf("Status of %+v is %v, want %v", c.Steps, res, c.Expect)
+		}
+	}
+
+}
@@ -0,0 +1,192 @@
+//
+// schedule.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ScheduledTask defines a recurring task enqueued at times matching a cron
+// schedule.
+type ScheduledTask struct {
+	// Name of the task; each enqueued task is named <name>-<scheduled time>.
+	Name string `yaml:"name"`
+	// Queue the task is enqueued to; the first queue this queue manager
+	// consumes is used if omitted.
+	Queue string `yaml:"queue,omitempty"`
+	// Cron is the schedule in the cron format, interpreted in UTC.
+	Cron string `yaml:"cron"`
+	// Script of the task.
+	Script *Script `yaml:"script"`
+
+	schedule *CronSchedule
+}
+
+// ReadSchedule reads a YAML file which has a list of scheduled tasks.
+func ReadSchedule(filename string) (tasks []*ScheduledTask, err error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	if err = yaml.Unmarshal(data, &tasks); err != nil {
+		return
+	}
+
+	for _, t := range tasks {
+		if t.Name == "" || t.Script == nil {
+			return nil, fmt.Errorf("scheduled task must have a name and a script: %+v", t)
+		}
+		if t.schedule, err = ParseCron(t.Cron); err != nil {
+			return nil, err
+		}
+	}
+	return
+
+}
+
+// ScheduleWaitInterval defines how long the queue manager waits before
+// fetching tasks again when queues are empty and it has scheduled tasks.
+const ScheduleWaitInterval = time.Minute
+
+// OccurrenceStore records occurrences of scheduled tasks enqueued by any
+// instances so that each occurrence is enqueued once.
+type OccurrenceStore interface {
+	// RecordOccurrence records an occurrence of a scheduled task; recorded is
+	// false if the same or a later occurrence has been recorded.
+	RecordOccurrence(ctx context.Context, name string, scheduled time.Time) (recorded bool, err error)
+	// ForgetOccurrence removes a recorded occurrence so that it can be
+	// recorded again.
+	ForgetOccurrence(ctx context.Context, name string, scheduled time.Time) error
+}
+
+// Materializer enqueues scheduled tasks when their times come.
+type Materializer struct {
+	Backend QueueBackend
+	// Occurrences is used to find tasks enqueued by other instances; it can
+	// be nil.
+	Occurrences OccurrenceStore
+	// Results is used to find tasks already run by other instances; it can
+	// be nil.
+	Results ResultStore
+	Tasks   []*ScheduledTask
+	// Queue is the default queue scheduled tasks are enqueued to.
+	Queue string
+
+	enqueued map[string]bool
+}
+
+// Materialize enqueues the last run of each scheduled task at or before a
+// given time unless it has been enqueued or run by this or other instances.
+// An enqueued task expires at the next scheduled time so that stale runs are
+// dropped.
+func (m *Materializer) Materialize(ctx context.Context, now time.Time, logger *log.Logger) (err error) {
+
+	if m.enqueued == nil {
+		m.enqueued = make(map[string]bool)
+	}
+	now = now.UTC()
+	for _, t := range m.Tasks {
+		scheduled := t.schedule.Prev(now)
+		if scheduled.IsZero() {
+			continue
+		}
+		name := fmt.Sprintf("%v-%v", t.Name, scheduled.Format(TimestampFormat))
+		if m.enqueued[name] {
+			continue
+		}
+		if m.Results != nil {
+			var res *TaskResult
+			if res, err = m.Results.Get(ctx, name); err != nil {
+				return
+			} else if res != nil {
+				m.enqueued[name] = true
+				continue
+			}
+		}
+
+		if m.Occurrences != nil {
+			var recorded bool
+			recorded, err = m.Occurrences.RecordOccurrence(ctx, t.Name, scheduled)
+			if err != nil {
+				return
+			} else if !recorded {
+				m.enqueued[name] = true
+				continue
+			}
+		}
+
+		s := *t.Script
+		s.Name = name
+		s.Queue = t.Queue
+		if s.Queue == "" {
+			s.Queue = m.Queue
+		}
+		if next := t.schedule.Next(scheduled); !next.IsZero() && s.ExpiresAt == nil {
+			s.ExpiresAt = &next
+		}
+		err = m.Backend.Enqueue(ctx, &Task{
+			Name:   s.Name,
+			Queue:  s.Queue,
+			Script: &s,
+		})
+		if err == ErrTaskExists {
+			// Another instance has enqueued the occurrence.
+			m.enqueued[name] = true
+			err = nil
+			continue
+		} else if err != nil {
+			if m.Occurrences != nil {
+				m.Occurrences.ForgetOccurrence(ctx, t.Name, scheduled)
+			}
+			return
+		}
+		m.enqueued[name] = true
+		logger.Println("Enqueued scheduled task", name, "to queue", s.Queue)
+	}
+	return
+
+}
+
+// expireTask records a script is dropped since it expired.
+func expireTask(ctx context.Context, cfg *Config, s *Script) error {
+
+	if cfg.Results == nil {
+		return nil
+	}
+	now := time.Now()
+	return cfg.Results.Put(ctx, &TaskResult{
+		Name:       s.Name,
+		Params:     s.Params,
+		Status:     TaskExpired,
+		Error:      fmt.Sprintf("expired at %v", s.ExpiresAt.Format(time.RFC3339)),
+		StartedAt:  now,
+		FinishedAt: now,
+	})
+
+}
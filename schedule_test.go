@@ -0,0 +1,182 @@
+//
+// schedule_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSchedule = `
+- name: nightly
+  cron: 0 3 * * *
+  script:
+    run:
+      - python sweep.py
+- name: report
+  queue: reports
+  cron: 0 9 * * 1
+  script:
+    run:
+      - python report.py
+    expires_at: 2017-07-20T00:00:00Z
+`
+
+func TestMaterialize(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "schedule.yml")
+	if err = ioutil.WriteFile(filename, []byte(testSchedule), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	tasks, err := ReadSchedule(filename)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := context.Background()
+	queue := new(testQueue)
+	store := &FileResultStore{Dir: filepath.Join(dir, "results")}
+	// The report of the last Monday has been run by another instance.
+	if err = store.Put(ctx, &TaskResult{Name: "report-20170703-090000", Status: TaskSucceeded}); err != nil {
+		t.Fatal(err.Error())
+	}
+	m := &Materializer{
+		Backend: queue,
+		Results: store,
+		Tasks:   tasks,
+		Queue:   "queue1",
+	}
+	logger := log.New(ioutil.Discard, "", 0)
+
+	now := time.Date(2017, 7, 5, 10, 30, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err = m.Materialize(ctx, now, logger); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if len(queue.tasks) != 1 {
+		t.Fatalf("%v tasks are enqueued, want 1", len(queue.tasks))
+	}
+	task := queue.tasks[0]
+	if task.Name != "nightly-20170705-030000" || task.Queue != "queue1" || task.Script.Name != task.Name {
+		t.Errorf("Enqueued task is %+v", task)
+	}
+	if expect := time.Date(2017, 7, 6, 3, 0, 0, 0, time.UTC); task.Script.ExpiresAt == nil || !task.Script.ExpiresAt.Equal(expect) {
+		t.Errorf("Enqueued task expires at %v, want %v", task.Script.ExpiresAt, expect)
+	}
+	if tasks[0].Script.ExpiresAt != nil {
+		t.Error("Scheduled script is modified")
+	}
+
+	now = time.Date(2017, 7, 10, 9, 0, 0, 0, time.UTC)
+	if err = m.Materialize(ctx, now, logger); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(queue.tasks) != 3 {
+		t.Fatalf("%v tasks are enqueued, want 3", len(queue.tasks))
+	}
+	task = queue.tasks[2]
+	if task.Name != "report-20170710-090000" || task.Queue != "reports" {
+		t.Errorf("Enqueued task is %+v", task)
+	}
+	if expect := time.Date(2017, 7, 20, 0, 0, 0, 0, time.UTC); task.Script.ExpiresAt == nil || !task.Script.ExpiresAt.Equal(expect) {
+		t.Errorf("Enqueued task expires at %v, want %v", task.Script.ExpiresAt, expect)
+	}
+
+}
+
+func TestMaterializeOccurrences(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "schedule.yml")
+	if err = ioutil.WriteFile(filename, []byte(testSchedule), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	tasks, err := ReadSchedule(filename)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Two instances share occurrences but not results.
+	server := httptest.NewServer(new(fakeDatastore))
+	defer server.Close()
+	backend := newTestGCPQueue(server, "instance-1")
+	queues := []*testQueue{new(testQueue), new(testQueue)}
+	ctx := context.Background()
+	now := time.Date(2017, 7, 5, 10, 30, 0, 0, time.UTC)
+	logger := log.New(ioutil.Discard, "", 0)
+	for _, queue := range queues {
+		m := &Materializer{
+			Backend:     queue,
+			Occurrences: backend,
+			Tasks:       tasks,
+			Queue:       "queue1",
+		}
+		if err = m.Materialize(ctx, now, logger); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if len(queues[0].tasks) != 2 || len(queues[1].tasks) != 0 {
+		t.Errorf("Instances enqueued %v and %v tasks, want 2 and 0", len(queues[0].tasks), len(queues[1].tasks))
+	}
+
+}
+
+func TestReadScheduleInvalid(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	for _, schedule := range []string{
+		"- name: nightly\n  cron: 0 3 * *\n  script:\n    run: [ls]\n",
+		"- name: nightly\n  cron: 0 3 * * *\n",
+	} {
+		filename := filepath.Join(dir, "schedule.yml")
+		if err = ioutil.WriteFile(filename, []byte(schedule), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, err = ReadSchedule(filename); err == nil {
+			t.Errorf("Invalid schedule %q is read", schedule)
+		}
+	}
+
+}
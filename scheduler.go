@@ -0,0 +1,133 @@
+//
+// scheduler.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// QueuePolicyStrict is the queue policy which fetches tasks from the
+	// first queue having tasks in the given order.
+	QueuePolicyStrict = "strict"
+	// QueuePolicyWeighted is the queue policy which fetches tasks from queues
+	// in proportion to their weights.
+	QueuePolicyWeighted = "weighted"
+)
+
+// QueueSpec defines a queue this queue manager consumes.
+type QueueSpec struct {
+	Name string
+	// Weight of the queue used in the weighted policy.
+	Weight int
+}
+
+// ParseQueues parses a comma separated list of queue names, each of which can
+// have a weight as <name>:<weight>; the default weight is 1.
+func ParseQueues(spec string) (queues []QueueSpec, err error) {
+
+	for _, v := range strings.Split(spec, ",") {
+		q := QueueSpec{
+			Name:   v,
+			Weight: 1,
+		}
+		if i := strings.LastIndex(v, ":"); i != -1 {
+			q.Name = v[:i]
+			q.Weight, err = strconv.Atoi(v[i+1:])
+			if err != nil || q.Weight <= 0 {
+				return nil, fmt.Errorf("invalid weight of queue %v: %v", q.Name, v[i+1:])
+			}
+		}
+		if q.Name == "" {
+			return nil, fmt.Errorf("invalid queue specification: %v", spec)
+		}
+		queues = append(queues, q)
+	}
+	return
+
+}
+
+// QueueNames returns names of given queues.
+func QueueNames(queues []QueueSpec) []string {
+	names := make([]string, len(queues))
+	for i, q := range queues {
+		names[i] = q.Name
+	}
+	return names
+}
+
+// Scheduler fetches tasks from several queues according to a queue policy.
+type Scheduler struct {
+	Backend QueueBackend
+	Queues  []QueueSpec
+	// Policy is either QueuePolicyStrict or QueuePolicyWeighted.
+	Policy string
+	// current has current weights of queues used in the smooth weighted
+	// round-robin.
+	current []int
+}
+
+// Fetch returns a task from the queue chosen by the policy; if the queue
+// doesn't have tasks, the other queues are checked in order. It returns nil
+// if no queues have tasks.
+func (s *Scheduler) Fetch(ctx context.Context) (task *Task, err error) {
+
+	for _, q := range s.order() {
+		task, err = s.Backend.Fetch(ctx, q.Name)
+		if err != nil || task != nil {
+			return
+		}
+	}
+	return
+
+}
+
+// order returns queues in the order tasks are fetched from them.
+func (s *Scheduler) order() []QueueSpec {
+
+	if s.Policy != QueuePolicyWeighted || len(s.Queues) < 2 {
+		return s.Queues
+	}
+
+	// Choose the first queue by the smooth weighted round-robin.
+	if len(s.current) != len(s.Queues) {
+		s.current = make([]int, len(s.Queues))
+	}
+	total := 0
+	selected := 0
+	for i, q := range s.Queues {
+		s.current[i] += q.Weight
+		total += q.Weight
+		if s.current[i] > s.current[selected] {
+			selected = i
+		}
+	}
+	s.current[selected] -= total
+
+	queues := []QueueSpec{s.Queues[selected]}
+	queues = append(queues, s.Queues[:selected]...)
+	return append(queues, s.Queues[selected+1:]...)
+
+}
@@ -0,0 +1,98 @@
+//
+// scheduler_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseQueues(t *testing.T) {
+
+	queues, err := ParseQueues("urgent:3,background")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expect := []QueueSpec{
+		QueueSpec{Name: "urgent", Weight: 3},
+		QueueSpec{Name: "background", Weight: 1},
+	}
+	if !reflect.DeepEqual(queues, expect) {
+		t.Errorf("Parsed queues are %+v, want %+v", queues, expect)
+	}
+
+	for _, spec := range []string{"", "urgent,", "urgent:0", "urgent:x", ":3"} {
+		if _, err = ParseQueues(spec); err == nil {
+			t.Errorf("Invalid specification %q is parsed", spec)
+		}
+	}
+
+}
+
+func TestSchedulerFetch(t *testing.T) {
+
+	ctx := context.Background()
+	newQueue := func() *testQueue {
+		queue := new(testQueue)
+		for _, name := range []string{"urgent", "background"} {
+			for i := 0; i < 10; i++ {
+				queue.tasks = append(queue.tasks, &Task{Name: name, Queue: name})
+			}
+		}
+		return queue
+	}
+	fetch := func(s *Scheduler, n int) (res []string) {
+		for i := 0; i < n; i++ {
+			task, err := s.Fetch(ctx)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if task == nil {
+				return
+			}
+			res = append(res, task.Queue)
+			s.Backend.Delete(ctx, task.Queue, task.Name)
+		}
+		return
+	}
+	queues := []QueueSpec{
+		QueueSpec{Name: "urgent", Weight: 2},
+		QueueSpec{Name: "background", Weight: 1},
+	}
+
+	strict := &Scheduler{Backend: newQueue(), Queues: queues, Policy: QueuePolicyStrict}
+	if res := fetch(strict, 11); res[9] != "urgent" || res[10] != "background" {
+		t.Errorf("Tasks are fetched from %v in the strict policy", res)
+	}
+
+	weighted := &Scheduler{Backend: newQueue(), Queues: queues, Policy: QueuePolicyWeighted}
+	expect := []string{"urgent", "background", "urgent", "urgent", "background", "urgent"}
+	if res := fetch(weighted, 6); !reflect.DeepEqual(res, expect) {
+		t.Errorf("Tasks are fetched from %v in the weighted policy, want %v", res, expect)
+	}
+	// Empty queues are skipped.
+	if res := fetch(weighted, 20); len(res) != 14 || res[13] != "background" {
+		t.Errorf("Remaining tasks are fetched from %v", res)
+	}
+
+}
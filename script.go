@@ -0,0 +1,222 @@
+//
+// script.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jkawamoto/roadie/script"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Script defines a script this queue manager executes. In addition to the
+// sections of roadie's script, it has sections only this queue manager uses.
+type Script struct {
+	// Name of this script, which is also used as the image name.
+	Name string `yaml:"-"`
+	// Queue is the name of the queue this script is fetched from.
+	Queue  string   `yaml:"-"`
+	Image  string   `yaml:"image,omitempty"`
+	APT    []string `yaml:"apt,omitempty"`
+	Source string   `yaml:"source,omitempty"`
+	Data   []string `yaml:"data,omitempty"`
+	Run    []Step   `yaml:"run,omitempty"`
+	Result string   `yaml:"result,omitempty"`
+	Upload []string `yaml:"upload,omitempty"`
+
+	// OnFailure steps run if a step in Run fails.
+	OnFailure []Step `yaml:"on_failure,omitempty"`
+	// Finally steps always run after Run and OnFailure steps.
+	Finally []Step `yaml:"finally,omitempty"`
+	// StopOnFailure is true if a failed step skips the remaining steps and
+	// uploads; otherwise all steps run and files are always uploaded.
+	StopOnFailure bool `yaml:"stop_on_failure,omitempty"`
+	// UploadOnFailure is true if files in Upload should be uploaded even if
+	// a step fails with StopOnFailure.
+	UploadOnFailure bool `yaml:"upload_on_failure,omitempty"`
+
+	// Matrix defines parameters and their values; the script is expanded into
+	// scripts for all combinations of them.
+	Matrix map[string][]string `yaml:"matrix,omitempty"`
+	// Params are the parameters of a script expanded from a matrix.
+	Params map[string]string `yaml:"params,omitempty"`
+	// Parent is the matrix task which enqueued this script as a child task.
+	Parent *Parent `yaml:"parent,omitempty"`
+	// Env defines environment variables of the sandbox container.
+	Env map[string]string `yaml:"env,omitempty"`
+	// Timeout of running the sandbox container; 0 means no timeouts.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// Logs defines names of log files of run steps.
+	Logs LogNames `yaml:"logs,omitempty"`
+	// Priority of the task; tasks having higher priorities are fetched
+	// first from a queue.
+	Priority int `yaml:"priority,omitempty"`
+	// NotBefore is the time before which this script doesn't run.
+	NotBefore *time.Time `yaml:"not_before,omitempty"`
+	// ExpiresAt is the time after which this script is dropped without
+	// running.
+	ExpiresAt *time.Time `yaml:"expires_at,omitempty"`
+	// Requires are labels an instance must have to run this script.
+	Requires []string `yaml:"requires,omitempty"`
+	// DependsOn are names of tasks which must succeed before this script runs.
+	DependsOn []string `yaml:"depends_on,omitempty"`
+	// Next defines follow-up tasks enqueued after this script ends.
+	Next *Next `yaml:"next,omitempty"`
+	// Secrets given to the sandbox container.
+	Secrets []SecretOpt `yaml:"secrets,omitempty"`
+	// Cache is true if results of a succeeded run of the same script are
+	// reused instead of running this script; see CacheKey.
+	Cache bool `yaml:"cache,omitempty"`
+}
+
+// Step defines a run step. In scripts, a step can be written as a command
+// string or a map which has the command and options.
+type Step struct {
+	// Name of this step; it must consist of alphanumerics, _, ., and -.
+	Name    string `yaml:"name,omitempty"`
+	Command string `yaml:"command,omitempty"`
+	// Timeout of this step; 0 means no timeouts.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Env defines environment variables of this step in addition to the
+	// script's ones.
+	Env map[string]string `yaml:"env,omitempty"`
+	// Workdir is the working directory of this step.
+	Workdir string `yaml:"workdir,omitempty"`
+	// Parallel steps run concurrently; a step having them is a parallel group
+	// and cannot have a command.
+	Parallel []Step `yaml:"parallel,omitempty"`
+	// Concurrency is the max number of parallel steps running at a time;
+	// 0 means no limits.
+	Concurrency int `yaml:"concurrency,omitempty"`
+}
+
+// step is an alias of Step to marshal and unmarshal it as a map.
+type step Step
+
+// UnmarshalYAML reads a step from a command string or a map.
+func (s *Step) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&s.Command); err == nil {
+		return nil
+	}
+	return unmarshal((*step)(s))
+}
+
+// MarshalYAML writes a step as a command string if it has no options so that
+// the script is compatible with roadie's one.
+func (s Step) MarshalYAML() (interface{}, error) {
+	if s.Name == "" && s.Timeout == 0 && len(s.Env) == 0 && s.Workdir == "" && len(s.Parallel) == 0 {
+		return s.Command, nil
+	}
+	return step(s), nil
+}
+
+// NewScript creates a script from a roadie's script.
+func NewScript(s *script.Script) *Script {
+	steps := make([]Step, len(s.Run))
+	for i, cmd := range s.Run {
+		steps[i].Command = cmd
+	}
+	return &Script{
+		Name:   s.Name,
+		Image:  s.Image,
+		APT:    s.APT,
+		Source: s.Source,
+		Data:   s.Data,
+		Run:    steps,
+		Result: s.Result,
+		Upload: s.Upload,
+	}
+}
+
+// ReadScript reads a script file; the name of the script is the file name
+// without the extension.
+func ReadScript(filename string) (s *Script, err error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	s = new(Script)
+	if err = yaml.Unmarshal(data, s); err != nil {
+		return
+	}
+	s.Name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	return
+
+}
+
+// RecoveryFile defines a file which has a task running in this instance so
+// that the task is resumed after the instance restarts.
+type RecoveryFile struct {
+	// Queue the task was fetched from.
+	Queue  string  `yaml:"queue"`
+	Script *Script `yaml:"script"`
+}
+
+// WriteRecoveryFile writes a task to a recovery file.
+func WriteRecoveryFile(filename string, task *Task) (err error) {
+
+	data, err := yaml.Marshal(&RecoveryFile{
+		Queue:  task.Queue,
+		Script: task.Script,
+	})
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+
+}
+
+// ReadRecoveryFile reads a task from a recovery file; the name of the task is
+// the file name without the extension. A file written by older versions has
+// only the script, and the queue of the task is empty.
+func ReadRecoveryFile(filename string) (task *Task, err error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	var f RecoveryFile
+	if err = yaml.Unmarshal(data, &f); err != nil {
+		return
+	}
+	if f.Script == nil {
+		f.Queue = ""
+		if f.Script, err = ReadScript(filename); err != nil {
+			return
+		}
+	}
+	f.Script.Name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	f.Script.Queue = f.Queue
+	task = &Task{
+		Name:   f.Script.Name,
+		Queue:  f.Queue,
+		Script: f.Script,
+	}
+	return
+
+}
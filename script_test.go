@@ -0,0 +1,156 @@
+//
+// script_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const testScript = `
+image: ubuntu:latest
+source: https://github.com/jkawamoto/roadie-queue-manager.git
+run:
+  - cmd1
+  - name: train
+    command: cmd2
+    timeout: 1h30m
+timeout: 2h
+result: gs://somebucket/result
+secrets:
+  - name: api-key
+  - name: service-account
+    file: /root/key.json
+`
+
+func TestReadScript(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "task-1.yml")
+	if err = ioutil.WriteFile(filename, []byte(testScript), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s, err := ReadScript(filename)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Name != "task-1" {
+		t.Errorf("Name of the script is %v, want task-1", s.Name)
+	}
+	if s.Image != "ubuntu:latest" || s.Result != "gs://somebucket/result" {
+		t.Errorf("Script isn't read correctly: %+v", s)
+	}
+	steps := []Step{
+		Step{Command: "cmd1"},
+		Step{Name: "train", Command: "cmd2", Timeout: 90 * time.Minute},
+	}
+	if !reflect.DeepEqual(s.Run, steps) {
+		t.Errorf("Run section is %+v, want %+v", s.Run, steps)
+	}
+	if s.Timeout != 2*time.Hour {
+		t.Errorf("Timeout is %v, want 2h", s.Timeout)
+	}
+	expect := []SecretOpt{
+		SecretOpt{Name: "api-key"},
+		SecretOpt{Name: "service-account", File: "/root/key.json"},
+	}
+	if !reflect.DeepEqual(s.Secrets, expect) {
+		t.Errorf("Secrets section is %+v, want %+v", s.Secrets, expect)
+	}
+
+}
+
+func TestRecoveryFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "task-1.yml")
+	task := &Task{
+		Name:   "task-1",
+		Queue:  "queue2",
+		Script: &Script{Name: "task-1", Queue: "queue2", Image: "ubuntu:latest"},
+	}
+	if err = WriteRecoveryFile(filename, task); err != nil {
+		t.Fatal(err.Error())
+	}
+	res, err := ReadRecoveryFile(filename)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(res, task) {
+		t.Errorf("Recovered task is %+v, want %+v", res, task)
+	}
+
+	// Files written by older versions have only the script.
+	if err = ioutil.WriteFile(filename, []byte(testScript), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if res, err = ReadRecoveryFile(filename); err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.Name != "task-1" || res.Queue != "" || res.Script.Image != "ubuntu:latest" {
+		t.Errorf("Recovered task is %+v", res)
+	}
+
+}
+
+func TestMarshalStep(t *testing.T) {
+
+	steps := []Step{
+		Step{Command: "cmd1"},
+		Step{Name: "train", Command: "cmd2", Timeout: time.Minute},
+	}
+	data, err := yaml.Marshal(steps)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// Steps without options must be written as strings.
+	expect := "- cmd1\n- name: train\n  command: cmd2\n  timeout: 1m0s\n"
+	if string(data) != expect {
+		t.Errorf("Marshaled steps are %q, want %q", string(data), expect)
+	}
+
+	var res []Step
+	if err = yaml.Unmarshal(data, &res); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(res, steps) {
+		t.Errorf("Unmarshaled steps are %+v, want %+v", res, steps)
+	}
+
+}
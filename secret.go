@@ -0,0 +1,328 @@
+//
+// secret.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// SecretMask defines a string which replaces secrets in logs.
+	SecretMask = "********"
+	// MinMaskedLineLength defines the minimum length of lines of multi-line
+	// secrets masked separately.
+	MinMaskedLineLength = 8
+)
+
+var (
+	// RegexpSecretName defines a regular expression of valid secret names.
+	RegexpSecretName = regexp.MustCompile(`^[A-Za-z0-9_.-]+(@[0-9]+)?$`)
+	// RegexpEnvName defines a regular expression of valid environment variable names.
+	RegexpEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// SecretOpt defines a secret given to a sandbox container.
+type SecretOpt struct {
+	// Name of the secret in the secret provider.
+	Name string `yaml:"name"`
+	// Env is the name of an environment variable the secret is set to.
+	Env string `yaml:"env,omitempty"`
+	// File is the path to a file the secret is written to in the container.
+	File string `yaml:"file,omitempty"`
+}
+
+// EnvName returns the environment variable name of this secret; if neither
+// Env nor File is given, the secret name in upper case is used.
+func (s *SecretOpt) EnvName() string {
+
+	if s.Env != "" || s.File != "" {
+		return s.Env
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, s.Name)
+
+}
+
+// SecretProvider resolves named secrets.
+type SecretProvider interface {
+	// Secret returns the value of a given secret.
+	Secret(ctx context.Context, name string) ([]byte, error)
+}
+
+// NewSecretProvider creates a secret provider from a specification
+// <type>:<argument>; supported types are
+//   - file:<dir> reads the file named after the secret in dir,
+//   - env:<prefix> reads the environment variable <prefix><name> of this process,
+//   - local:<file> reads a YAML file which works as a stand-in for a secret
+//     manager; see LocalSecretManager.
+func NewSecretProvider(spec string) (p SecretProvider, err error) {
+
+	kv := strings.SplitN(spec, ":", 2)
+	if len(kv) != 2 {
+		return nil, fmt.Errorf("secret provider must be <type>:<argument>: %v", spec)
+	}
+	switch kv[0] {
+	case "file":
+		p = &FileSecretProvider{Dir: kv[1]}
+	case "env":
+		p = &EnvSecretProvider{Prefix: kv[1]}
+	case "local":
+		p = &LocalSecretManager{Filename: kv[1]}
+	default:
+		err = fmt.Errorf("unknown secret provider: %v", kv[0])
+	}
+	return
+
+}
+
+// FileSecretProvider reads secrets from files in a directory.
+type FileSecretProvider struct {
+	Dir string
+}
+
+// Secret returns the contents of the file named after the secret.
+func (p *FileSecretProvider) Secret(ctx context.Context, name string) ([]byte, error) {
+	if !RegexpSecretName.MatchString(name) {
+		return nil, fmt.Errorf("invalid secret name: %v", name)
+	}
+	return ioutil.ReadFile(filepath.Join(p.Dir, name))
+}
+
+// EnvSecretProvider reads secrets from environment variables of this process.
+type EnvSecretProvider struct {
+	Prefix string
+}
+
+// Secret returns the value of the environment variable Prefix + the secret
+// name in upper case.
+func (p *EnvSecretProvider) Secret(ctx context.Context, name string) ([]byte, error) {
+	key := p.Prefix + (&SecretOpt{Name: name}).EnvName()
+	value, exist := os.LookupEnv(key)
+	if !exist {
+		return nil, fmt.Errorf("secret %v is not found", name)
+	}
+	return []byte(value), nil
+}
+
+// LocalSecretManager is a stand-in for a secret manager service, which reads
+// secrets from a YAML file mapping secret names to lists of versions:
+//
+//	api-key:
+//	  - first version
+//	  - second version
+//
+// A secret name can have a version number starting from 1 after @, e.g.
+// api-key@1; the latest version is used if the version is omitted.
+// The file is read every time a secret is requested.
+type LocalSecretManager struct {
+	Filename string
+}
+
+// Secret returns a version of the secret.
+func (p *LocalSecretManager) Secret(ctx context.Context, name string) (value []byte, err error) {
+
+	if !RegexpSecretName.MatchString(name) {
+		return nil, fmt.Errorf("invalid secret name: %v", name)
+	}
+
+	data, err := ioutil.ReadFile(p.Filename)
+	if err != nil {
+		return
+	}
+	var secrets map[string][]string
+	if err = yaml.Unmarshal(data, &secrets); err != nil {
+		return
+	}
+
+	version := 0
+	if idx := strings.LastIndex(name, "@"); idx != -1 {
+		version, _ = strconv.Atoi(name[idx+1:])
+		name = name[:idx]
+	}
+	versions := secrets[name]
+	if version == 0 {
+		version = len(versions)
+	}
+	if version < 1 || version > len(versions) {
+		return nil, fmt.Errorf("secret %v is not found", name)
+	}
+	return []byte(versions[version-1]), nil
+
+}
+
+// ResolveSecrets retrieves values of given secrets from a provider.
+func ResolveSecrets(ctx context.Context, p SecretProvider, secrets []SecretOpt) (values [][]byte, err error) {
+
+	if len(secrets) != 0 && p == nil {
+		return nil, fmt.Errorf("secrets are requested but no secret providers are given")
+	}
+
+	values = make([][]byte, len(secrets))
+	for i, s := range secrets {
+		if env := s.EnvName(); env != "" && !RegexpEnvName.MatchString(env) {
+			return nil, fmt.Errorf("invalid environment variable name for secret %v: %v", s.Name, env)
+		}
+		if values[i], err = p.Secret(ctx, s.Name); err != nil {
+			return nil, fmt.Errorf("cannot resolve secret %v: %v", s.Name, err)
+		}
+	}
+	return
+
+}
+
+// maskWriter writes log messages to a logger after masking secrets.
+type maskWriter struct {
+	logger  *log.Logger
+	secrets [][]byte
+}
+
+// NewMaskedLogger returns a logger which writes messages to a given logger
+// after replacing given secrets with SecretMask.
+func NewMaskedLogger(logger *log.Logger, secrets [][]byte) *log.Logger {
+	return log.New(&maskWriter{
+		logger:  logger,
+		secrets: secrets,
+	}, "", 0)
+}
+
+// Write masks secrets in a given message and writes it to the logger.
+func (w *maskWriter) Write(p []byte) (int, error) {
+	if err := w.logger.Output(2, MaskSecrets(string(p), w.secrets)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// MaskSecrets replaces given secrets in a message with SecretMask. Since
+// outputs are often processed line by line, each line of a multi-line secret
+// is also replaced if it isn't too short to be a part of other messages.
+func MaskSecrets(msg string, secrets [][]byte) string {
+	for _, s := range secrets {
+		// Secrets read from files often end with a new line.
+		if s = bytes.TrimSpace(s); len(s) == 0 {
+			continue
+		}
+		msg = strings.Replace(msg, string(s), SecretMask, -1)
+		if !bytes.Contains(s, []byte("\n")) {
+			continue
+		}
+		for _, line := range bytes.Split(s, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) >= MinMaskedLineLength {
+				msg = strings.Replace(msg, string(line), SecretMask, -1)
+			}
+		}
+	}
+	return msg
+}
+
+// DigestSecret returns a digest of a secret, <length>:<SHA-256 of the salt and
+// the secret in hex>, which lets MaskDigests find the secret in messages
+// without having it.
+func DigestSecret(salt, secret []byte) string {
+	secret = bytes.TrimSpace(secret)
+	return fmt.Sprintf("%v:%x", len(secret), sha256.Sum256(append(append([]byte{}, salt...), secret...)))
+}
+
+// MaskDigests replaces substrings of a message which have given digests made
+// by DigestSecret with SecretMask; only substrings without white spaces are
+// checked since credentials don't have them.
+func MaskDigests(msg string, salt []byte, digests []string) string {
+
+	lengths := make(map[int]bool)
+	sums := make(map[string]bool)
+	for _, d := range digests {
+		kv := strings.SplitN(d, ":", 2)
+		if n, err := strconv.Atoi(kv[0]); err == nil && n > 0 && len(kv) == 2 {
+			lengths[n] = true
+			sums[d] = true
+		}
+	}
+	if len(sums) == 0 {
+		return msg
+	}
+
+	buf := bytes.NewBuffer(nil)
+	end := 0
+	for i := 0; i < len(msg); {
+		// end is the end of the word having i.
+		if i >= end {
+			if end = strings.IndexFunc(msg[i:], unicode.IsSpace); end == -1 {
+				end = len(msg)
+			} else {
+				end += i
+			}
+		}
+		matched := 0
+		for n := range lengths {
+			if n > matched && i+n <= end && sums[DigestSecret(salt, []byte(msg[i:i+n]))] {
+				matched = n
+			}
+		}
+		if matched != 0 {
+			buf.WriteString(SecretMask)
+			i += matched
+			continue
+		}
+		buf.WriteByte(msg[i])
+		i++
+	}
+	return buf.String()
+
+}
+
+// MaskFiles replaces secrets in regular files in a directory with SecretMask
+// by a given function.
+func MaskFiles(dir string, mask func(msg string) string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if masked := mask(string(data)); masked != string(data) {
+			return ioutil.WriteFile(path, []byte(masked), info.Mode().Perm())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,271 @@
+//
+// step.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// LogDir defines the directory logs of run steps are written in sandbox
+	// containers; all files in it are uploaded to the result URL.
+	LogDir = "/tmp/logs"
+	// DefaultStdoutLog defines the default name of stdout logs.
+	DefaultStdoutLog = "stdout{{step}}.txt"
+	// DefaultStderrLog defines the default name of stderr logs.
+	DefaultStderrLog = "stderr{{step}}.txt"
+	// DefaultCombinedLog defines the default name of logs which have both
+	// stdout and stderr.
+	DefaultCombinedLog = "log{{step}}.txt"
+	// LogNameNone defines a log name which disables the log.
+	LogNameNone = "none"
+	// TimeoutExitStatus defines the exit status of steps killed by timeouts.
+	TimeoutExitStatus = 124
+)
+
+// LogNames defines naming schemes of log files of run steps; {{step}} in a
+// name is replaced with the index of the step starting from 0.
+type LogNames struct {
+	Stdout   string `yaml:"stdout,omitempty"`
+	Stderr   string `yaml:"stderr,omitempty"`
+	Combined string `yaml:"combined,omitempty"`
+}
+
+// StepLogs returns paths to the stdout, stderr, and combined logs of the i-th
+// step; empty paths mean the logs are disabled.
+func (n *LogNames) StepLogs(i int) (logs *StepLogs, err error) {
+
+	logs = new(StepLogs)
+	for _, v := range []struct {
+		name string
+		def  string
+		path *string
+	}{
+		{n.Stdout, DefaultStdoutLog, &logs.Stdout},
+		{n.Stderr, DefaultStderrLog, &logs.Stderr},
+		{n.Combined, DefaultCombinedLog, &logs.Combined},
+	} {
+		name := v.name
+		if name == "" {
+			name = v.def
+		} else if name == LogNameNone {
+			continue
+		}
+		name = strings.Replace(name, "{{step}}", strconv.Itoa(i), -1)
+		if name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+			return nil, fmt.Errorf("invalid log name: %v", name)
+		}
+		*v.path = filepath.Join(LogDir, name)
+	}
+	return
+
+}
+
+// StepLogs defines paths to log files of a run step.
+type StepLogs struct {
+	Stdout   string
+	Stderr   string
+	Combined string
+}
+
+// lockedWriter serializes writes from multiple goroutines.
+type lockedWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// Write writes given bytes to the underlying writer.
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writer.Write(p)
+}
+
+// PrefixWriter writes a prefix at the beginning of each line.
+type PrefixWriter struct {
+	Prefix string
+	Writer io.Writer
+	// midline is true if the last written byte isn't a new line.
+	midline bool
+}
+
+// Write writes given bytes with the prefix.
+func (w *PrefixWriter) Write(p []byte) (n int, err error) {
+
+	buf := bytes.NewBuffer(nil)
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if !w.midline {
+			buf.WriteString(w.Prefix)
+		}
+		buf.Write(line)
+		w.midline = line[len(line)-1] != '\n'
+	}
+	if _, err = w.Writer.Write(buf.Bytes()); err != nil {
+		return
+	}
+	return len(p), nil
+
+}
+
+// RunStep runs a command and writes its stdout and stderr to given writers as
+// well as log files; the combined log has both outputs in the order they are
+// written. The command and its child processes are killed if it doesn't end
+// within a given timeout, which is 0 for no timeouts. The returned error
+// doesn't include the command's own failure, which is in the result.
+func RunStep(cmd *exec.Cmd, logs *StepLogs, timeout time.Duration, stdout, stderr io.Writer) (res *StepResult, err error) {
+
+	stdouts := []io.Writer{stdout}
+	stderrs := []io.Writer{stderr}
+	for _, v := range []struct {
+		path    string
+		writers *[]io.Writer
+	}{
+		{logs.Stdout, &stdouts},
+		{logs.Stderr, &stderrs},
+	} {
+		if v.path == "" {
+			continue
+		}
+		var fp *os.File
+		if fp, err = createLog(v.path); err != nil {
+			return
+		}
+		defer fp.Close()
+		*v.writers = append(*v.writers, fp)
+	}
+	if logs.Combined != "" {
+		var fp *os.File
+		if fp, err = createLog(logs.Combined); err != nil {
+			return
+		}
+		defer fp.Close()
+		combined := &lockedWriter{writer: fp}
+		stdouts = append(stdouts, combined)
+		stderrs = append(stderrs, combined)
+	}
+
+	cmd.Stdout = io.MultiWriter(stdouts...)
+	cmd.Stderr = io.MultiWriter(stderrs...)
+	// The command runs in a new process group so that its child processes
+	// are also killed on timeouts.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	res = &StepResult{
+		StartedAt: time.Now(),
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	var expired int32
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&expired, 1)
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		})
+		defer timer.Stop()
+	}
+	err = cmd.Wait()
+	res.FinishedAt = time.Now()
+
+	if atomic.LoadInt32(&expired) != 0 {
+		res.TimedOut = true
+		res.ExitStatus = TimeoutExitStatus
+		return res, nil
+	}
+	if _, ok := err.(*exec.ExitError); ok || err == nil {
+		res.ExitStatus = exitStatus(err)
+		err = nil
+	}
+	return
+
+}
+
+// RunParallel runs given shell command lines concurrently and returns their
+// exit statuses; at most concurrency commands run at a time, and 0 means no
+// limits.
+func RunParallel(lines []string, concurrency int, stdout, stderr io.Writer) []int {
+
+	if concurrency <= 0 || concurrency > len(lines) {
+		concurrency = len(lines)
+	}
+	stdout = &lockedWriter{writer: stdout}
+	stderr = &lockedWriter{writer: stderr}
+
+	statuses := make([]int, len(lines))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, line := range lines {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(i int, line string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			cmd := exec.Command("sh", "-c", line)
+			cmd.Stdout = stdout
+			cmd.Stderr = stderr
+			statuses[i] = exitStatus(cmd.Run())
+		}(i, line)
+	}
+	wg.Wait()
+	return statuses
+
+}
+
+// createLog creates a log file and its parent directory.
+func createLog(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// exitStatus returns the exit status of a command from an error returned by
+// RunStep.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if e, ok := err.(*exec.ExitError); ok {
+		if status, ok := e.Sys().(syscall.WaitStatus); ok {
+			if status.Signaled() {
+				return 128 + int(status.Signal())
+			}
+			return status.ExitStatus()
+		}
+	}
+	return ExitCodeError
+}
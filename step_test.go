@@ -0,0 +1,181 @@
+//
+// step_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogNames(t *testing.T) {
+
+	logs, err := (&LogNames{}).StepLogs(2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expect := StepLogs{
+		Stdout:   LogDir + "/stdout2.txt",
+		Stderr:   LogDir + "/stderr2.txt",
+		Combined: LogDir + "/log2.txt",
+	}
+	if *logs != expect {
+		t.Errorf("Default logs are %+v, want %+v", *logs, expect)
+	}
+
+	logs, err = (&LogNames{
+		Stdout:   "step-{{step}}.out",
+		Stderr:   "step-{{step}}.err",
+		Combined: LogNameNone,
+	}).StepLogs(0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expect = StepLogs{
+		Stdout: LogDir + "/step-0.out",
+		Stderr: LogDir + "/step-0.err",
+	}
+	if *logs != expect {
+		t.Errorf("Logs are %+v, want %+v", *logs, expect)
+	}
+
+	if _, err = (&LogNames{Stdout: "../stdout.txt"}).StepLogs(0); err == nil {
+		t.Error("A log outside the log directory is accepted")
+	}
+
+}
+
+func TestRunStep(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	logs := &StepLogs{
+		Stdout:   filepath.Join(dir, "logs", "stdout.txt"),
+		Stderr:   filepath.Join(dir, "logs", "stderr.txt"),
+		Combined: filepath.Join(dir, "logs", "log.txt"),
+	}
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	cmd := exec.Command("sh", "-c", "echo out1; sleep 0.1; echo err >&2; sleep 0.1; echo out2; exit 3")
+	res, err := RunStep(cmd, logs, 0, stdout, stderr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.ExitStatus != 3 || res.TimedOut {
+		t.Errorf("Result is %+v, want exit status 3", res)
+	}
+
+	cases := map[string]string{
+		logs.Stdout:   "out1\nout2\n",
+		logs.Stderr:   "err\n",
+		logs.Combined: "out1\nerr\nout2\n",
+	}
+	for path, expect := range cases {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(data) != expect {
+			t.Errorf("%v has %q, want %q", filepath.Base(path), string(data), expect)
+		}
+	}
+	if stdout.String() != "out1\nout2\n" || stderr.String() != "err\n" {
+		t.Errorf("Outputs are %q and %q", stdout.String(), stderr.String())
+	}
+
+}
+
+func TestPrefixWriter(t *testing.T) {
+
+	buf := bytes.NewBuffer(nil)
+	w := &PrefixWriter{Prefix: "[step0] ", Writer: buf}
+	for _, str := range []string{"line1\nli", "ne2\n", "\nline4"} {
+		if _, err := w.Write([]byte(str)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if expect := "[step0] line1\n[step0] line2\n[step0] \n[step0] line4"; buf.String() != expect {
+		t.Errorf("Written outputs are %q, want %q", buf.String(), expect)
+	}
+
+}
+
+func TestRunStepTimeout(t *testing.T) {
+
+	// The child process of sh must be also killed; otherwise RunStep waits
+	// until it ends since it holds the stdout.
+	start := time.Now()
+	cmd := exec.Command("sh", "-c", "sleep 10 | cat; echo never")
+	stdout := bytes.NewBuffer(nil)
+	res, err := RunStep(cmd, &StepLogs{}, 100*time.Millisecond, stdout, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !res.TimedOut || res.ExitStatus != TimeoutExitStatus {
+		t.Errorf("Result is %+v, want a timeout", res)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Step was killed after %v", elapsed)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Outputs of the killed step are %q", stdout.String())
+	}
+
+}
+
+func TestRunParallel(t *testing.T) {
+
+	stdout := bytes.NewBuffer(nil)
+	lines := []string{
+		"sleep 0.2; echo step0",
+		"sleep 0.2; echo step1; exit 2",
+		"sleep 0.2; echo step2",
+		"sleep 0.2; echo step3 >&2",
+	}
+	start := time.Now()
+	statuses := RunParallel(lines, 2, stdout, ioutil.Discard)
+	elapsed := time.Since(start)
+
+	if expect := []int{0, 2, 0, 0}; !reflect.DeepEqual(statuses, expect) {
+		t.Errorf("Exit statuses are %v, want %v", statuses, expect)
+	}
+	// Two rounds are needed to run four steps two at a time.
+	if elapsed < 400*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("Steps ran in %v", elapsed)
+	}
+	for _, step := range []string{"step0", "step1", "step2"} {
+		if !strings.Contains(stdout.String(), step+"\n") {
+			t.Errorf("Outputs %q don't have outputs of %v", stdout.String(), step)
+		}
+	}
+
+}
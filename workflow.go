@@ -0,0 +1,151 @@
+//
+// workflow.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Next defines follow-up tasks enqueued after a task ends.
+type Next struct {
+	// OnSuccess tasks are enqueued if the task succeeds.
+	OnSuccess []FollowUp `yaml:"on_success,omitempty"`
+	// OnFailure tasks are enqueued if the task fails or times out.
+	OnFailure []FollowUp `yaml:"on_failure,omitempty"`
+}
+
+// Parent defines a matrix task which enqueued its expanded scripts as child
+// tasks.
+type Parent struct {
+	Name string `yaml:"name"`
+	// Next defines follow-up tasks of the matrix task, which are enqueued once
+	// after all children end.
+	Next *Next `yaml:"next,omitempty"`
+}
+
+// FollowUp defines a follow-up task.
+type FollowUp struct {
+	// Name of the task; <task>-next<index> is used if omitted.
+	Name string `yaml:"name,omitempty"`
+	// Queue the task is enqueued to; the queue of the finished task is used
+	// if omitted.
+	Queue string `yaml:"queue,omitempty"`
+	// Script of the task; {{input}} in it is replaced with the result
+	// location of the finished task.
+	Script *Script `yaml:"script"`
+}
+
+// FollowUpTasks returns follow-up tasks of a script according to its result.
+func FollowUpTasks(s *Script, res *TaskResult) (tasks []*Task, err error) {
+
+	if s.Next == nil {
+		return
+	}
+	followUps := s.Next.OnFailure
+	if res.Status == TaskSucceeded {
+		followUps = s.Next.OnSuccess
+	}
+
+	for i, f := range followUps {
+		if f.Script == nil {
+			return nil, fmt.Errorf("follow-up task %v of %v doesn't have a script", i, s.Name)
+		}
+		task := &Task{
+			Name:  f.Name,
+			Queue: f.Queue,
+			Script: Substitute(f.Script, map[string]string{
+				"input": res.Result,
+			}),
+		}
+		if task.Name == "" {
+			task.Name = fmt.Sprintf("%v-next%v", s.Name, i)
+		}
+		if task.Queue == "" {
+			task.Queue = s.Queue
+		}
+		task.Script.Name = task.Name
+		task.Script.Queue = task.Queue
+		tasks = append(tasks, task)
+	}
+	return
+
+}
+
+// finishParent stores the aggregated result of the matrix task which enqueued
+// a given child script and enqueues follow-up tasks of the matrix task if all
+// of its children have ended. Results of the children must be in a result
+// store shared among instances. Children ending at the same time may both
+// aggregate the result, but each follow-up task is enqueued only once since a
+// task isn't enqueued while another task of the same name is in the queue.
+func finishParent(ctx context.Context, backend QueueBackend, cfg *Config, s *Script, logger *log.Logger) (err error) {
+
+	if s.Parent == nil || cfg.Results == nil {
+		return
+	}
+	parent, err := cfg.Results.Get(ctx, s.Parent.Name)
+	if err != nil || parent == nil || parent.Status != TaskEnqueued {
+		return
+	}
+	results := make([]*TaskResult, len(parent.Children))
+	for i, name := range parent.Children {
+		if results[i], err = cfg.Results.Get(ctx, name); err != nil || results[i] == nil {
+			// Other children haven't ended yet.
+			return
+		}
+	}
+
+	res := MatrixResult(&Script{Name: parent.Name}, results)
+	res.Children = parent.Children
+	if err = cfg.Results.Put(ctx, res); err != nil {
+		return
+	}
+	logger.Println("All child tasks of", parent.Name, "ended with status", res.Status)
+	return enqueueFollowUps(ctx, backend, &Script{
+		Name:  parent.Name,
+		Queue: s.Queue,
+		Next:  s.Parent.Next,
+	}, res, logger)
+
+}
+
+// enqueueFollowUps enqueues follow-up tasks of a finished script.
+func enqueueFollowUps(ctx context.Context, backend QueueBackend, s *Script, res *TaskResult, logger *log.Logger) (err error) {
+
+	tasks, err := FollowUpTasks(s, res)
+	if err != nil {
+		return
+	}
+	for _, task := range tasks {
+		switch e := backend.Enqueue(ctx, task); e {
+		case nil:
+			logger.Println("Enqueued follow-up task", task.Name, "to queue", task.Queue)
+		case ErrTaskExists:
+			logger.Println("Follow-up task", task.Name, "is already in queue", task.Queue)
+		default:
+			return e
+		}
+	}
+	return
+
+}
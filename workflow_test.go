@@ -0,0 +1,92 @@
+//
+// workflow_test.go
+//
+// Copyright (c) 2016-2017 Junpei Kawamoto
+//
+// This file is part of Roadie queue manager.
+//
+// Roadie Queue Manager is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Queue Manager is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie queue manager. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const testWorkflowScript = `
+run:
+  - python train.py
+next:
+  on_success:
+    - queue: evaluation
+      script:
+        data:
+          - "{{input}}model.h5"
+        run:
+          - python evaluate.py model.h5
+    - name: notify
+      script:
+        run:
+          - echo {{input}}
+  on_failure:
+    - script:
+        run:
+          - echo failed
+`
+
+func TestFollowUpTasks(t *testing.T) {
+
+	s := new(Script)
+	if err := yaml.Unmarshal([]byte(testWorkflowScript), s); err != nil {
+		t.Fatal(err.Error())
+	}
+	s.Name = "train"
+	s.Queue = "training"
+
+	tasks, err := FollowUpTasks(s, &TaskResult{
+		Status: TaskSucceeded,
+		Result: "gs://somebucket/train/",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("%v follow-up tasks are created, want 2", len(tasks))
+	}
+	if task := tasks[0]; task.Name != "train-next0" || task.Queue != "evaluation" || task.Script.Data[0] != "gs://somebucket/train/model.h5" {
+		t.Errorf("First follow-up task is %+v (%+v)", task, task.Script)
+	}
+	if task := tasks[1]; task.Name != "notify" || task.Queue != "training" || task.Script.Run[0].Command != "echo gs://somebucket/train/" {
+		t.Errorf("Second follow-up task is %+v (%+v)", task, task.Script)
+	}
+	if s.Next.OnSuccess[0].Script.Data[0] != "{{input}}model.h5" {
+		t.Error("Original script is modified")
+	}
+
+	queue := new(testQueue)
+	err = enqueueFollowUps(context.Background(), queue, s, &TaskResult{Status: TaskTimeout}, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(queue.tasks) != 1 || queue.tasks[0].Script.Run[0].Command != "echo failed" {
+		t.Errorf("Enqueued tasks are %+v", queue.tasks)
+	}
+
+}